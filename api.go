@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	apiPrefix    = "/v1/"
+	defAPIWindow = 5 * time.Minute
+)
+
+// API is a read-only JSON API over recent statistics:
+//
+//	GET /v1/stats?window=5m     totals, status distribution and rates
+//	GET /v1/sections?top=20     most visited sections, accepts window too
+//	GET /v1/alerts              alert history and current state per rule
+type API struct {
+	config  func() *Config // configuration in effect, changes on reload
+	history *History
+}
+
+// statsResponse is a body of /v1/stats.
+type statsResponse struct {
+	Window      string         `json:"window"`  // requested window
+	Covered     string         `json:"covered"` // part of the window data is available for
+	Hits        int            `json:"hits"`
+	Bytes       int64          `json:"bytes"`
+	AvgBytes    float64        `json:"avgBytes"` // average response size
+	MaxBytes    int64          `json:"maxBytes"` // largest response
+	HitsPerSec  float64        `json:"hitsPerSec"`
+	BytesPerSec float64        `json:"bytesPerSec"`
+	StatusCodes map[string]int `json:"statusCodes"`
+	Methods     map[string]int `json:"methods"`
+	AvgTraffic  float64        `json:"avgTraffic"` // hits per second as of the last poll
+}
+
+// sectionsResponse is a body of /v1/sections.
+type sectionsResponse struct {
+	Window   string         `json:"window"`
+	Sections []Pair         `json:"sections"`
+	Errors   map[string]int `json:"errors,omitempty"` // heavy hitters mode: maximum overestimation of section counts
+}
+
+// alertsResponse is a body of /v1/alerts.
+type alertsResponse struct {
+	Rules   map[string]ruleState `json:"rules"`
+	History []alertRecord        `json:"history"`
+}
+
+// NewAPI returns an API over history, settings are read from config on every request.
+func NewAPI(config func() *Config, history *History) *API {
+	return &API{
+		config:  config,
+		history: history,
+	}
+}
+
+// Register adds API handlers to mux.
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc(apiPrefix+"stats", a.stats)
+	mux.HandleFunc(apiPrefix+"sections", a.sections)
+	mux.HandleFunc(apiPrefix+"alerts", a.alerts)
+}
+
+func (a *API) stats(w http.ResponseWriter, r *http.Request) {
+	window, err := a.window(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	t, covered := a.history.Window(window)
+
+	out := statsResponse{
+		Window:      window.String(),
+		Covered:     covered.String(),
+		Hits:        t.Hits,
+		Bytes:       t.Bytes,
+		AvgBytes:    t.AvgBytes(),
+		MaxBytes:    t.MaxBytes,
+		StatusCodes: make(map[string]int),
+		Methods:     t.Methods,
+	}
+
+	for _, g := range []uint8{2, 3, 4, 5} {
+		out.StatusCodes[strconv.Itoa(int(g))+"xx"] = t.StatusCodes[g]
+	}
+
+	if covered > 0 {
+		out.HitsPerSec = float64(t.Hits) / covered.Seconds()
+		out.BytesPerSec = float64(t.Bytes) / covered.Seconds()
+	}
+
+	if last := a.history.Last(); last != nil {
+		out.AvgTraffic = last.AvgTraffic
+	}
+
+	writeJSON(w, out)
+}
+
+func (a *API) sections(w http.ResponseWriter, r *http.Request) {
+	window, err := a.window(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	n := a.config().TopN
+	if v := r.URL.Query().Get("top"); v != "" {
+		i, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || i == 0 {
+			writeError(w, fmt.Errorf("Invalid top value: %s", v))
+			return
+		}
+		n = uint(i)
+	}
+
+	t, _ := a.history.Window(window)
+	hl := CutTopN(RankByHits(t.Sections), n)
+
+	out := sectionsResponse{
+		Window:   window.String(),
+		Sections: make([]Pair, len(hl)),
+	}
+	for i := 0; i < len(hl); i++ {
+		out.Sections[i] = hl[i]
+		if t.Top != nil {
+			if out.Errors == nil {
+				out.Errors = make(map[string]int, len(hl))
+			}
+			out.Errors[hl[i].Key] = t.Top.Err(hl[i].Key)
+		}
+	}
+
+	writeJSON(w, out)
+}
+
+func (a *API) alerts(w http.ResponseWriter, r *http.Request) {
+	history, rules := a.history.Alerts()
+
+	if history == nil {
+		history = []alertRecord{}
+	}
+
+	writeJSON(w, alertsResponse{
+		Rules:   rules,
+		History: history,
+	})
+}
+
+// window reads a window query parameter, ex. 30s, 5m or 1h.
+func (a *API) window(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("window")
+	if v == "" {
+		return defAPIWindow, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid window value: %s", v)
+	}
+
+	return d, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
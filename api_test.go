@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testAPI() *http.ServeMux {
+	h := NewHistory(time.Second, time.Hour)
+	start := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		st := stateOK
+		if i == 2 {
+			st = stateAlert
+		}
+		h.Send(&Sample{
+			AvgTraffic: float64(i),
+			Kind:       sampleKindPoll,
+			States:     map[string]uint8{ruleTraffic: st},
+			Tally: &Tally{
+				Bytes:       100,
+				Hits:        2,
+				MaxBytes:    50 + int64(i)*10,
+				Methods:     map[string]int{"GET": 2},
+				Sections:    map[string]int{"/shuttle": 1, "/images": i},
+				StatusCodes: map[uint8]int{2: 1, 5: 1},
+			},
+			Time: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	mux := http.NewServeMux()
+	NewAPI(func() *Config { return &Config{TopN: 10} }, h).Register(mux)
+	return mux
+}
+
+func apiGet(t *testing.T, mux *http.ServeMux, url string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Cannot decode %s response: %s\n%s", url, err.Error(), rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestAPI_stats(t *testing.T) {
+	var actual statsResponse
+	apiGet(t, testAPI(), "/v1/stats?window=2s", &actual)
+
+	expected := statsResponse{
+		Window:      "2s",
+		Covered:     "2s",
+		Hits:        4,
+		Bytes:       200,
+		AvgBytes:    50,
+		MaxBytes:    80,
+		HitsPerSec:  2,
+		BytesPerSec: 100,
+		StatusCodes: map[string]int{"2xx": 2, "3xx": 0, "4xx": 0, "5xx": 2},
+		Methods:     map[string]int{"GET": 4},
+		AvgTraffic:  3,
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+
+	var e map[string]string
+	if code := apiGet(t, testAPI(), "/v1/stats?window=abc", &e); code != http.StatusBadRequest || e["error"] == "" {
+		t.Errorf("Expected %d with an error, got %d %+v", http.StatusBadRequest, code, e)
+	}
+}
+
+func TestAPI_sections(t *testing.T) {
+	var actual sectionsResponse
+	apiGet(t, testAPI(), "/v1/sections?top=1", &actual)
+
+	expected := sectionsResponse{
+		Window:   "5m0s",
+		Sections: []Pair{{"/images", 6}},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestAPI_alerts(t *testing.T) {
+	var actual alertsResponse
+	apiGet(t, testAPI(), "/v1/alerts", &actual)
+
+	if len(actual.History) != 2 || actual.History[0].Type != alertEscalation || actual.History[1].Type != alertDeescalation {
+		t.Errorf("Unexpected history %+v", actual.History)
+	}
+
+	if actual.Rules[ruleTraffic].Name != "ok" {
+		t.Errorf("Unexpected rules %+v", actual.Rules)
+	}
+}
@@ -2,76 +2,545 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	// Argument defaults.
-	defAlertThreshold = 1000 // hits per interval
-	defMTF            = 120  // Monitoring time frame, sec
-	defPollInt        = 1    // sec, 1sec - minimum
-	defReportInt      = 10   // Default stat summary interval, sec
+	defAlertThreshold = 1000            // hits per second
+	defMTF            = 2 * time.Minute // Monitoring time frame
+	defPollInt        = time.Second
+	defMinPollInt     = 10 * time.Millisecond
+	defMaxKeys        = 10000            // distinct sections, methods and sources kept per counter
+	defReportInt      = 10 * time.Second // Default stat summary interval
 	defTopN           = 10
 	defSendAlerts     = true
 	defSendReports    = true
 	defSendTicks      = true
+	defWatch          = true
+	defWindows        = "1m,5m,15m" // rolling windows shown along with the MTF average
+
+	// Environment variables overriding configuration are named after flags, ex. HTM_LOG_FILE for --log-file.
+	envPrefix = "HTM_"
 )
 
 // Config is a program configuration object.
 type Config struct {
-	AlertThreshold int
-	File           string
+	AdminAddr      string  // admin endpoints listen address, disabled if empty
+	AlertThreshold float64 // hits per second
+	APIAddr        string  // query API listen address, disabled if empty
+	APIRetention   time.Duration
+	Files          []string // log files or glob patterns
+	GraphiteAddr   string   // Carbon plaintext listener address, disabled if empty
+	GraphitePrefix string
+	HeavyHitters   int    // Space-Saving capacity of section counters, 0 - exact counts
+	HTTPAddr       string // web dashboard listen address, disabled if empty
+	InfluxFile     string // InfluxDB line protocol output file, disabled if empty
+	InfluxMeas     string // InfluxDB measurement name
+	InfluxURL      string // InfluxDB write endpoint, disabled if empty
+	LogFormat      string // log line format, see parserFormat
 	MaxPolls       int
-	MTF            int // sec
-	PollInt        int // sec
-	ReportInt      int // sec
+	MaxKeys        int    // distinct sections, methods and sources kept per counter, 0 - no limit
+	MaxReplay      int64  // bytes of backlog replayed after a restart, 0 - no limit
+	MetricsAddr    string // Prometheus exporter listen address, disabled if empty
+	MTF            time.Duration
+	OTLPAttrs      map[string]string
+	OTLPEndpoint   string // OTLP/HTTP metrics endpoint, disabled if empty
+	PollInt        time.Duration
+	ReportInt      time.Duration
+	Rules          []Rule // alert rules in addition to the built-in traffic rule
 	SendAlerts     bool
+	SnapshotFile   string // frame and alert states snapshot file, disabled if empty
 	SendReports    bool
 	SendTicks      bool
+	StateFile      string // read offsets state file, disabled if empty
+	StateInterval  time.Duration
+	StatsdAddr     string // StatsD server address, disabled if empty
+	StatsdPrefix   string
+	StatsdTags     bool   // DogStatsD tag syntax
+	SyslogAddr     string // syslog listen address (UDP and TCP), disabled if empty
 	TopN           uint
+	UI             string          // ui*
+	Visitors       string          // visitors*, client identity distinct visitors are counted by
+	Watch          bool            // read log files on file events in addition to polls
+	Windows        []time.Duration // rolling windows, load average style
+}
+
+// ValidationError lists all problems found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
 }
 
-// NewConfig initializes program configuration and runs basic validation of user-defined arguments.
-// By default, all properties are set to def* constants.
-func NewConfig() *Config {
-	at := flag.Int("alert-threshold", defAlertThreshold, "Alert threshold")
-	lf := flag.String("log-file", "", "Log file.")
-	mtf := flag.Int("mtf", defMTF, "Monitoring time frame (seconds)")
-	pi := flag.Int("poll-interval", defPollInt, "Log polling interval (seconds). 1 sec - mim allowed value.")
-	ri := flag.Int("report-interval", defReportInt, "Report interval.")
-	sa := flag.Bool("send-alerts", defSendAlerts, "Send alerts")
-	sr := flag.Bool("send-reports", defSendReports, "Send reports")
-	st := flag.Bool("send-ticks", defSendTicks, "Send tick information")
-	tn := flag.Uint("top-n", defTopN, "Number of top section hits displayed during polls")
-	flag.Parse()
+// NewConfig initializes program configuration and runs validation of user-defined arguments.
+// Sources, in order of increasing priority: def* constants, a configuration file set with --config,
+// HTM_* environment variables and command line arguments.
+// All problems found are returned at once as a *ValidationError.
+func NewConfig(args []string) (*Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	ad := fs.String("admin-addr", "", "Address to serve admin endpoints on, ex. 127.0.0.1:8082. Disabled if empty.")
+	at := fs.Float64("alert-threshold", defAlertThreshold, "Alert threshold, average hits per second, ex. 0.5.")
+	aa := fs.String("api-addr", "", "Address to serve the JSON query API on, ex. :8081. Disabled if empty.")
+	ar := durationFlag(fs, "api-retention", defHistoryRetention, "How long poll data is kept for API queries, ex. 30m, 2h.")
+	cf := fs.String("config", "", "Configuration file (TOML).")
+	ga := fs.String("graphite-addr", "", "Graphite (Carbon plaintext) address to send poll and report metrics to, ex. 127.0.0.1:2003. Disabled if empty.")
+	gp := fs.String("graphite-prefix", defGraphitePrefix, "Prefix of Graphite metric paths.")
+	hh := fs.Int("heavy-hitters", 0, "Count sections approximately with this many Space-Saving counters, for logs with millions of unique paths. 0 - exact counts.")
+	ha := fs.String("http", "", "Address to serve the web dashboard on, ex. :8080. Disabled if empty.")
+	inf := fs.String("influx-file", "", "File to append poll and report metrics to in InfluxDB line protocol. Disabled if empty.")
+	inm := fs.String("influx-measurement", defInfluxMeasurement, "InfluxDB measurement name.")
+	inu := fs.String("influx-url", "", "InfluxDB write endpoint, ex. http://127.0.0.1:8086/write?db=traffic. Disabled if empty.")
+	lf := &listFlag{}
+	fs.Var(lf, "log-file", "Log file or glob pattern, ex. /var/log/nginx/*.access.log. Repeat or separate with commas for several.")
+	lfm := fs.String("log-format", parserFormat, "Log line format, nginx log_format style. Must contain $request and $status.")
+	ma := fs.String("metrics-addr", "", "Address to serve Prometheus metrics on, ex. :9100. Disabled if empty.")
+	mk := fs.Int("max-keys", defMaxKeys, "Maximum distinct sections, methods and sources counted, the rest is counted as \"other\". 0 - no limit.")
+	mr := fs.Int64("max-replay", defMaxReplay, "Maximum backlog replayed after a restart, bytes. 0 - no limit.")
+	mp := fs.Int("max-polls", 0, "Stop after this number of polls. 0 - run until interrupted.")
+	mtf := durationFlag(fs, "mtf", defMTF, "Monitoring time frame, ex. 2m, 90s.")
+	oa := fs.String("otlp-attrs", "", "Extra OTLP resource attributes, ex. env=prod,dc=east.")
+	oe := fs.String("otlp-endpoint", "", "OTLP/HTTP metrics endpoint, ex. http://127.0.0.1:4318/v1/metrics. Disabled if empty.")
+	osn := fs.String("otlp-service-name", defOTLPServiceName, "OTLP service.name resource attribute.")
+	pi := durationFlag(fs, "poll-interval", defPollInt, "Log polling interval and traffic frame resolution, ex. 1s, 250ms. 10ms - min allowed value.")
+	ri := durationFlag(fs, "report-interval", defReportInt, "Report interval, ex. 10s.")
+	sa := fs.Bool("send-alerts", defSendAlerts, "Send alerts")
+	sr := fs.Bool("send-reports", defSendReports, "Send reports")
+	st := fs.Bool("send-ticks", defSendTicks, "Send tick information")
+	sda := fs.String("statsd-addr", "", "StatsD server address to push metrics to every poll, ex. 127.0.0.1:8125. Disabled if empty.")
+	sdp := fs.String("statsd-prefix", "", "Prefix of StatsD metric names.")
+	sdt := fs.Bool("statsd-tags", false, "Use DogStatsD tags for sections, status classes and rules.")
+	snf := fs.String("snapshot-file", "", "File to persist the traffic frame and alert states in, they are restored after a restart. Disabled if empty.")
+	sf := fs.String("state-file", "", "File to persist read offsets in, reading resumes from them after a restart. Disabled if empty.")
+	si := durationFlag(fs, "state-interval", defStateInterval, "How often read offsets and the snapshot are saved, ex. 10s.")
+	sya := fs.String("syslog-addr", "", "Address to receive syslog messages on over UDP and TCP, ex. :5514. Disabled if empty.")
+	tn := fs.Uint("top-n", defTopN, "Number of top section hits displayed during polls")
+	ui := fs.String("ui", uiConsole, "Output mode: console - stream of messages, tui - full-screen dashboard.")
+	vi := fs.String("visitors", visitorsIP, "Count distinct visitors by: ip, ip+ua - address and user agent, off.")
+	wl := &listFlag{}
+	fs.Var(wl, "windows", "Rolling windows to show rates of and use in rules as rate_<window>, ex. 1m,5m,15m (default).")
+	wt := fs.Bool("watch", defWatch, "Read log files as soon as they are written (Linux, inotify). Polls still set the traffic frame resolution.")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Every source of settings replaces lists set by a previous one.
+	layer := func() {
+		lf.layer()
+		wl.layer()
+	}
+
+	layer()
+
+	var problems []string
+	var rules []Rule
+
+	if *cf == "" {
+		*cf = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if *cf != "" {
+		doc, err := loadConfigFile(*cf)
+		if err != nil {
+			return nil, &ValidationError{[]string{err.Error()}}
+		}
+		rules, problems = applyConfigFile(fs, doc)
+	}
+
+	layer()
+	problems = append(problems, applyEnv(fs)...)
+
+	// Command line arguments take precedence over the file and environment.
+	layer()
+	fs.Parse(args)
+
+	if len(lf.values) == 0 && *sya == "" {
+		problems = append(problems, "Log file or syslog address is not provided.")
+	}
+
+	for _, p := range lf.values {
+		if _, err := filepath.Match(p, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid log file pattern %q.", p))
+		}
+	}
 
-	if *lf == "" {
-		panic("Log file is not provided.")
+	if !strings.Contains(*lfm, "$request") || !strings.Contains(*lfm, "$status") {
+		problems = append(problems, "Log format must contain $request and $status fields.")
 	}
 
-	if *pi < 1 {
-		panic("Invalid polling interval set. Minimal allowed value is 1 second.")
+	if *pi < defMinPollInt {
+		problems = append(problems, fmt.Sprintf("Invalid polling interval set. Minimal allowed value is %s.", defMinPollInt))
 	}
 
 	if *ri < *pi {
-		// via pollInt we also check for reportInt to be > 0
-		panic("Report interval cannot be smaller than polling interval.")
+		problems = append(problems, "Report interval cannot be smaller than polling interval.")
 	}
 
 	if *mtf < *pi {
-		panic("Monitoring time frame cannot be smaller than polling interval.")
+		problems = append(problems, "Monitoring time frame cannot be smaller than polling interval.")
+	}
+
+	if *ar <= 0 {
+		problems = append(problems, "API retention must be positive.")
+	}
+
+	if *hh < 0 {
+		problems = append(problems, "Heavy hitters capacity cannot be negative.")
+	}
+
+	if *hh > 0 && *hh < int(*tn) {
+		problems = append(problems, "Heavy hitters capacity cannot be smaller than top-n.")
+	}
+
+	if *mk < 0 {
+		problems = append(problems, "Max keys cannot be negative.")
+	}
+
+	if *mr < 0 {
+		problems = append(problems, "Max replay cannot be negative.")
+	}
+
+	if *si <= 0 {
+		problems = append(problems, "State interval must be positive.")
+	}
+
+	if *mp < 0 {
+		problems = append(problems, "Max polls cannot be negative.")
+	}
+
+	if *vi != visitorsIP && *vi != visitorsIPUA && *vi != visitorsOff {
+		problems = append(problems, "Invalid visitors mode. Allowed values: ip, ip+ua, off.")
+	}
+
+	if *ui != uiConsole && *ui != uiTUI {
+		problems = append(problems, "Invalid UI mode. Allowed values: console, tui.")
+	}
+
+	for _, p := range lf.values {
+		if p == stdinName && *ui == uiTUI {
+			problems = append(problems, "TUI reads keys from stdin, it cannot be used with --log-file=-.")
+		}
+	}
+
+	if len(wl.values) == 0 {
+		wl.Set(defWindows)
+	}
+
+	var windows []time.Duration
+	for _, v := range wl.values {
+		var d durationValue
+		switch err := d.Set(v); {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("Invalid window %q.", v))
+		case time.Duration(d) < *pi:
+			problems = append(problems, fmt.Sprintf("Window %s cannot be smaller than polling interval.", v))
+		default:
+			windows = append(windows, time.Duration(d))
+		}
+	}
+
+	metrics := ruleMetricsFor(windows, *vi != visitorsOff, logsLatency(*lfm))
+	names := map[string]bool{}
+	for i := range rules {
+		problems = append(problems, rules[i].validate(metrics)...)
+		if names[rules[i].Name] {
+			problems = append(problems, fmt.Sprintf("Rule %q is defined more than once.", rules[i].Name))
+		}
+		names[rules[i].Name] = true
+	}
+
+	otlpAttrs, err := parseAttrs(*oa)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{problems}
+	}
+
+	if _, ok := otlpAttrs["service.name"]; !ok {
+		otlpAttrs["service.name"] = *osn
+	}
+
+	if _, ok := otlpAttrs["host.name"]; !ok {
+		if h, err := os.Hostname(); err == nil {
+			otlpAttrs["host.name"] = h
+		}
+	}
+
+	maxPolls := *mp
+	if maxPolls == 0 {
+		maxPolls = math.MaxInt32 - 1
 	}
 
 	return &Config{
-		MaxPolls:       math.MaxInt32 - 1,
+		MaxKeys:        *mk,
+		MaxPolls:       maxPolls,
+		MaxReplay:      *mr,
+		AdminAddr:      *ad,
 		AlertThreshold: *at,
-		File:           *lf,
+		APIAddr:        *aa,
+		APIRetention:   *ar,
+		Files:          lf.values,
+		GraphiteAddr:   *ga,
+		GraphitePrefix: *gp,
+		HeavyHitters:   *hh,
+		HTTPAddr:       *ha,
+		InfluxFile:     *inf,
+		InfluxMeas:     *inm,
+		InfluxURL:      *inu,
+		LogFormat:      *lfm,
+		MetricsAddr:    *ma,
 		MTF:            *mtf,
+		OTLPAttrs:      otlpAttrs,
+		OTLPEndpoint:   *oe,
 		PollInt:        *pi,
 		ReportInt:      *ri,
+		Rules:          rules,
 		SendAlerts:     *sa,
+		SnapshotFile:   *snf,
 		SendReports:    *sr,
 		SendTicks:      *st,
+		StateFile:      *sf,
+		StateInterval:  *si,
+		StatsdAddr:     *sda,
+		StatsdPrefix:   *sdp,
+		StatsdTags:     *sdt,
+		SyslogAddr:     *sya,
 		TopN:           *tn,
+		UI:             *ui,
+		Visitors:       *vi,
+		Watch:          *wt,
+		Windows:        windows,
+	}, nil
+}
+
+// loadConfigFile reads and parses a configuration file.
+func loadConfigFile(path string) (tomlTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open configuration file: %s", err.Error())
+	}
+	defer f.Close()
+
+	doc, err := parseTOML(f)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse configuration file %s: %s", path, err.Error())
+	}
+
+	return doc, nil
+}
+
+// applyConfigFile sets flags from a configuration file and reads alert rules.
+// Every file key corresponds to a flag: top level keys are flag names with "_" instead of "-",
+// keys of a [table] are prefixed with its name, ex. "addr" in [statsd] sets --statsd-addr.
+// Rules are defined as a [[rules]] array of tables.
+func applyConfigFile(fs *flag.FlagSet, doc tomlTable) ([]Rule, []string) {
+	var problems []string
+	var rules []Rule
+
+	var set func(key string, v interface{})
+	set = func(key string, v interface{}) {
+		name := strings.Replace(key, "_", "-", -1)
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			problems = append(problems, fmt.Sprintf("Unknown configuration key %q.", key))
+			return
+		}
+
+		// Arrays set list flags, ex. log_file = ["a.log", "b.log"].
+		if arr, ok := v.([]interface{}); ok {
+			if _, ok := f.Value.(*listFlag); !ok {
+				problems = append(problems, fmt.Sprintf("Configuration key %q cannot be an array.", key))
+				return
+			}
+			for _, item := range arr {
+				set(key, item)
+			}
+			return
+		}
+
+		s, ok := tomlScalar(v)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Configuration key %q must be a string, number or boolean.", key))
+			return
+		}
+
+		if err := fs.Set(name, s); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid value %q of configuration key %q.", s, key))
+		}
+	}
+
+	for _, k := range sortedTOMLKeys(doc) {
+		switch v := doc[k].(type) {
+		case tomlTable:
+			for _, sk := range sortedTOMLKeys(v) {
+				set(k+"_"+sk, v[sk])
+			}
+
+		case []tomlTable:
+			if k != "rules" {
+				problems = append(problems, fmt.Sprintf("Unknown configuration key %q.", k))
+				continue
+			}
+			for i, t := range v {
+				r, p := tomlRule(i, t)
+				rules = append(rules, r)
+				problems = append(problems, p...)
+			}
+
+		default:
+			set(k, v)
+		}
+	}
+
+	return rules, problems
+}
+
+// tomlRule reads an alert rule definition.
+func tomlRule(i int, t tomlTable) (Rule, []string) {
+	var r Rule
+	var problems []string
+
+	for _, k := range sortedTOMLKeys(t) {
+		var ok bool
+
+		switch k {
+		case "name":
+			r.Name, ok = t[k].(string)
+		case "metric":
+			r.Metric, ok = t[k].(string)
+		case "threshold":
+			switch v := t[k].(type) {
+			case int64:
+				r.Threshold, ok = float64(v), true
+			case float64:
+				r.Threshold, ok = v, true
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("Rule #%d: unknown key %q.", i+1, k))
+			continue
+		}
+
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Rule #%d: invalid type of %q.", i+1, k))
+		}
+	}
+
+	return r, problems
+}
+
+// applyEnv sets flags from HTM_* environment variables.
+func applyEnv(fs *flag.FlagSet) []string {
+	var problems []string
+
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+
+		v, ok := os.LookupEnv(env)
+		if !ok || f.Name == "config" {
+			return
+		}
+
+		if err := fs.Set(f.Name, v); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid value %q of environment variable %s.", v, env))
+		}
+	})
+
+	return problems
+}
+
+// tomlScalar converts a scalar TOML value into a flag value.
+func tomlScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func sortedTOMLKeys(t tomlTable) []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// listFlag is a flag which can be repeated or set to a comma-separated list.
+type listFlag struct {
+	values []string
+	fresh  bool // next Set replaces values
+}
+
+func (f *listFlag) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	if f.fresh {
+		f.values = nil
+		f.fresh = false
+	}
+
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			f.values = append(f.values, item)
+		}
 	}
+
+	return nil
+}
+
+// layer starts a new source of settings, values are kept unless the source sets them.
+func (f *listFlag) layer() {
+	f.fresh = true
+}
+
+// durationValue is a duration flag which also accepts a plain number of seconds, ex. "2" or "0.25" along with "250ms".
+type durationValue time.Duration
+
+// durationFlag defines a duration flag accepting plain numbers as seconds.
+func durationFlag(fs *flag.FlagSet, name string, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	*p = value
+	fs.Var((*durationValue)(p), name, usage)
+	return p
+}
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *durationValue) Set(s string) error {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = durationValue(v * float64(time.Second))
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(v)
+
+	return nil
 }
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "htm-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.toml")
+	writeConfigFile(t, path, content)
+
+	return path
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewConfig_Precedence(t *testing.T) {
+	path := writeTestConfig(t, `
+# Monitor settings.
+log_file = "/var/log/access.log"
+alert_threshold = 50
+send_ticks = false
+max_polls = 10
+
+[statsd]
+addr = "127.0.0.1:8125"
+prefix = "web"
+
+[[rules]]
+name = "errors"
+metric = "hits_5xx"
+threshold = 5
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Setenv("HTM_ALERT_THRESHOLD", "60")
+	os.Setenv("HTM_STATSD_PREFIX", "env")
+	defer os.Unsetenv("HTM_ALERT_THRESHOLD")
+	defer os.Unsetenv("HTM_STATSD_PREFIX")
+
+	cfg, err := NewConfig([]string{"--config", path, "--statsd-prefix", "cli"})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	if cfg.Files[0] != "/var/log/access.log" || cfg.StatsdAddr != "127.0.0.1:8125" {
+		t.Errorf("File values are not applied: %+v", cfg)
+	}
+
+	if cfg.SendTicks || cfg.MaxPolls != 10 {
+		t.Errorf("Expected ticks off and %d max polls, got %v and %d", 10, cfg.SendTicks, cfg.MaxPolls)
+	}
+
+	// Environment overrides the file, arguments override both.
+	if cfg.AlertThreshold != 60 {
+		t.Errorf("Expected alert threshold %d, got %v", 60, cfg.AlertThreshold)
+	}
+	if cfg.StatsdPrefix != "cli" {
+		t.Errorf("Expected statsd prefix %s, got %s", "cli", cfg.StatsdPrefix)
+	}
+
+	expected := []Rule{{Name: "errors", Metric: metricHits5xx, Threshold: 5}}
+	if !reflect.DeepEqual(expected, cfg.Rules) {
+		t.Errorf("Expected rules %+v, got %+v", expected, cfg.Rules)
+	}
+}
+
+func TestNewConfig_Validation(t *testing.T) {
+	path := writeTestConfig(t, `
+poll_interval = 0
+colour = "red"
+
+[[rules]]
+name = "traffic"
+metric = "latency"
+threshold = 0
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := NewConfig([]string{"--config", path, "--ui", "gui"})
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a validation error, got %+v", err)
+	}
+
+	// Every problem is reported at once.
+	expected := []string{
+		"colour",
+		"Log file or syslog address is not provided",
+		"polling interval",
+		"Invalid UI mode",
+		"reserved",
+		"unknown metric",
+		"threshold must be positive",
+	}
+	if len(verr.Problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d:\n%s", len(expected), len(verr.Problems), verr.Error())
+	}
+	for i, p := range expected {
+		if !strings.Contains(verr.Problems[i], p) {
+			t.Errorf("Problem %d: expected %q to mention %q", i, verr.Problems[i], p)
+		}
+	}
+}
+
+func TestNewConfig_Defaults(t *testing.T) {
+	cfg, err := NewConfig([]string{"--log-file", "access.log"})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	if cfg.LogFormat != parserFormat || cfg.PollInt != defPollInt || cfg.MaxPolls <= 0 || len(cfg.Rules) != 0 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestNewConfig_Files(t *testing.T) {
+	cfg, err := NewConfig([]string{"--log-file", "a.log,/var/log/*.log", "--log-file", "b.log"})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	expected := []string{"a.log", "/var/log/*.log", "b.log"}
+	if !reflect.DeepEqual(expected, cfg.Files) {
+		t.Errorf("Expected files %q, got %q", expected, cfg.Files)
+	}
+
+	if _, err := NewConfig([]string{"--log-file", "[a.log"}); err == nil {
+		t.Error("Expected a malformed pattern to fail validation")
+	}
+}
+
+func TestNewConfig_Durations(t *testing.T) {
+	path := writeTestConfig(t, "log_file = \"access.log\"\nmtf = 90\nreport_interval = \"1m\"\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// Plain numbers are seconds.
+	cfg, err := NewConfig([]string{"--config", path, "--poll-interval", "250ms", "--state-interval", "0.5"})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	if cfg.PollInt != 250*time.Millisecond || cfg.MTF != 90*time.Second || cfg.ReportInt != time.Minute || cfg.StateInterval != 500*time.Millisecond {
+		t.Errorf("Unexpected durations: %+v", cfg)
+	}
+
+	if _, err := NewConfig([]string{"--log-file", "access.log", "--poll-interval", "5ms"}); err == nil {
+		t.Error("Expected a too short poll interval to fail validation")
+	}
+}
+
+func TestNewConfig_FractionalThresholds(t *testing.T) {
+	path := writeTestConfig(t, `
+log_file = "access.log"
+alert_threshold = 0.5
+
+[[rules]]
+name = "errors"
+metric = "hits_5xx"
+threshold = 0.5
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := NewConfig([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	if cfg.AlertThreshold != 0.5 || len(cfg.Rules) != 1 || cfg.Rules[0].Threshold != 0.5 {
+		t.Errorf("Expected thresholds of 0.5, got %v and %+v", cfg.AlertThreshold, cfg.Rules)
+	}
+}
+
+func TestNewConfig_Windows(t *testing.T) {
+	path := writeTestConfig(t, `
+log_file = "access.log"
+
+[[rules]]
+name = "sustained"
+metric = "rate_5m"
+threshold = 10
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := NewConfig([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	expected := []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+	if !reflect.DeepEqual(expected, cfg.Windows) {
+		t.Errorf("Expected windows %v, got %v", expected, cfg.Windows)
+	}
+
+	// Rules can only reference configured windows.
+	if _, err := NewConfig([]string{"--config", path, "--windows", "1m,15m"}); err == nil {
+		t.Error("Expected a rule on a missing window to fail validation")
+	}
+
+	if _, err := NewConfig([]string{"--log-file", "access.log", "--windows", "1m,soon"}); err == nil {
+		t.Error("Expected a malformed window to fail validation")
+	}
+}
+
+func TestNewConfig_HeavyHitters(t *testing.T) {
+	cfg, err := NewConfig([]string{"--log-file", "access.log", "--heavy-hitters", "100"})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+	if cfg.HeavyHitters != 100 {
+		t.Errorf("Expected heavy hitters capacity %d, got %d", 100, cfg.HeavyHitters)
+	}
+
+	if _, err := NewConfig([]string{"--log-file", "access.log", "--heavy-hitters", "5", "--top-n", "10"}); err == nil {
+		t.Error("Expected a capacity below top-n to fail validation")
+	}
+}
+
+func TestNewConfig_Visitors(t *testing.T) {
+	path := writeTestConfig(t, `
+log_file = "access.log"
+
+[[rules]]
+name = "crowd"
+metric = "visitors_1m"
+threshold = 10000
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := NewConfig([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+	if cfg.Visitors != visitorsIP {
+		t.Errorf("Expected visitors counted by %q, got %q", visitorsIP, cfg.Visitors)
+	}
+
+	if _, err := NewConfig([]string{"--config", path, "--visitors", "off"}); err == nil {
+		t.Error("Expected a rule on visitors to fail validation when they are not counted")
+	}
+
+	if _, err := NewConfig([]string{"--log-file", "access.log", "--visitors", "cookie"}); err == nil {
+		t.Error("Expected an unknown visitors mode to fail validation")
+	}
+}
+
+func TestNewConfig_LatencyRules(t *testing.T) {
+	path := writeTestConfig(t, `
+log_file = "access.log"
+
+[[rules]]
+name = "slow"
+metric = "latency_p99_5m"
+threshold = 0.5
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	if _, err := NewConfig([]string{"--config", path}); err == nil {
+		t.Error("Expected a latency rule to fail validation with a log format without request time")
+	}
+
+	format := parserFormat + " $request_time"
+	if _, err := NewConfig([]string{"--config", path, "--log-format", format}); err != nil {
+		t.Fatalf("NewConfig should not fail. Error: %+v", err)
+	}
+
+	if _, err := NewConfig([]string{"--config", path, "--log-format", format, "--windows", "1m"}); err == nil {
+		t.Error("Expected a latency rule on a missing window to fail validation")
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/satyrius/gonx"
 )
@@ -10,12 +12,19 @@ import (
 // Entry represents a request based on a log entry data:
 // "GET /shuttle/technology/sts-newsref/srb.html HTTP/1.0" 200
 type Entry struct {
+	BytesSent  int64 // response body size, 0 if logged as "-"
+	HasLatency bool
+	Latency    time.Duration // request duration, valid if HasLatency
 	Method     string
 	Path       string
 	parser     *gonx.Parser
 	Section    string
+	Source     string // name of the source the entry was read from, empty if there is one
 	Protocol   string
+	RemoteAddr string // client address, empty if not logged
 	StatusCode string // response code to a given request
+	UserAgent  string // empty if not logged
+	Visitor    string // client identity distinct visitors are counted by, empty if not counted
 }
 
 // NewEntry represents log entry.
@@ -59,5 +68,123 @@ func (r *Entry) ParseLine(line string) error {
 		return err
 	}
 
+	// Client fields are optional, they are used to count distinct visitors.
+	if v, err := e.Field("remote_addr"); err == nil {
+		r.RemoteAddr = v
+	}
+	if v, err := e.Field("http_user_agent"); err == nil {
+		r.UserAgent = v
+	}
+
+	r.parseLatency(e)
+
+	// Size is optional for custom log formats.
+	if b, err := e.Field("bytes_sent"); err == nil {
+		r.BytesSent, err = parseBytes(b)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// maxLatency is the longest request duration accepted, longer values are treated as malformed.
+const maxLatency = 24 * time.Hour
+
+// latencyFields lists log fields request durations are read from, in order of preference.
+var latencyFields = []string{"request_time", "request_time_us", "upstream_response_time"}
+
+// logsLatency tells whether a log format has a request duration field.
+func logsLatency(format string) bool {
+	for _, f := range latencyFields {
+		if strings.Contains(format, "$"+f) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLatency reads request duration of the first of optional fields logged:
+// $request_time in seconds, $request_time_us in microseconds (Apache %D)
+// or $upstream_response_time in seconds, a sum of all upstreams tried.
+// A malformed or implausible value leaves the entry without latency, the rest of it is still counted.
+func (r *Entry) parseLatency(e *gonx.Entry) {
+	var d time.Duration
+	var err error
+
+	if v, ferr := e.Field("request_time"); ferr == nil && v != "-" {
+		d, err = parseSeconds(v)
+	} else if v, ferr := e.Field("request_time_us"); ferr == nil && v != "-" {
+		d, err = parseMicros(v)
+	} else if v, ferr := e.Field("upstream_response_time"); ferr == nil {
+		d, err = parseUpstreamTimes(v)
+	} else {
+		return
+	}
+
+	if err != nil || d < 0 {
+		return
+	}
+	r.Latency, r.HasLatency = d, true
+}
+
+// parseUpstreamTimes sums upstream response times in seconds, -1 is returned if no upstream was tried.
+// Several upstreams are separated with commas and colons, ex. "0.012, 0.020 : 0.031".
+func parseUpstreamTimes(s string) (time.Duration, error) {
+	sum := time.Duration(-1)
+
+	for _, part := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ':' || c == ' ' }) {
+		if part == "-" {
+			continue
+		}
+		d, err := parseSeconds(part)
+		if err != nil {
+			return 0, err
+		}
+		if sum < 0 {
+			sum = 0
+		}
+		sum += d
+	}
+
+	if sum > maxLatency {
+		return 0, fmt.Errorf("Invalid request time value: %s", s)
+	}
+	return sum, nil
+}
+
+// parseSeconds converts a duration logged in seconds, ex. "0.123", up to maxLatency.
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(f >= 0 && f <= maxLatency.Seconds()) {
+		return 0, fmt.Errorf("Invalid request time value: %s", s)
+	}
+
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// parseMicros converts a duration logged in microseconds, ex. "2500", up to maxLatency.
+func parseMicros(s string) (time.Duration, error) {
+	us, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || us < 0 || us > int64(maxLatency/time.Microsecond) {
+		return 0, fmt.Errorf("Invalid request time value: %s", s)
+	}
+
+	return time.Duration(us) * time.Microsecond, nil
+}
+
+// parseBytes converts a CLF size field into a number of bytes.
+// Servers log "-" instead of 0 when no body was sent.
+func parseBytes(s string) (int64, error) {
+	if s == "-" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid bytes sent value: %s", s)
+	}
+
+	return n, nil
+}
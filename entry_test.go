@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/satyrius/gonx"
 )
@@ -48,4 +49,75 @@ func TestRequest_ParseEntry(t *testing.T) {
 		t.Errorf("Expected %d, got %d", expected2, actual2)
 	}
 
+	expected3 := int64(49553)
+	actual3 := r.BytesSent
+	if expected3 != actual3 {
+		t.Errorf("Expected %d, got %d", expected3, actual3)
+	}
+}
+
+func TestRequest_ParseEntry_NoBytes(t *testing.T) {
+
+	parser := gonx.NewParser(parserFormat)
+
+	testString := `128.203.26.245 - - [28/Jul/1995:13:16:32 -0400] "GET /software HTTP/1.0" 304 -`
+
+	r := NewEntry(parser)
+	err := r.ParseLine(testString)
+	if err != nil {
+		t.Fatalf("ParseEntry should not fail. Error: %+v", err)
+	}
+
+	if r.BytesSent != 0 {
+		t.Errorf("Expected %d, got %d", 0, r.BytesSent)
+	}
+}
+
+func TestRequest_ParseEntry_Latency(t *testing.T) {
+	request := `"GET /shuttle/index.html HTTP/1.0" 200 100`
+
+	tests := []struct {
+		format, line string
+		latency      time.Duration
+		has          bool
+	}{
+		{`"$request" $status $bytes_sent $request_time`, request + ` 0.125`, 125 * time.Millisecond, true},
+		{`"$request" $status $bytes_sent $request_time_us`, request + ` 2500`, 2500 * time.Microsecond, true},
+		{`"$request" $status $bytes_sent "$upstream_response_time"`, request + ` "0.010, 0.020 : 0.030"`, 60 * time.Millisecond, true},
+		{`"$request" $status $bytes_sent "$upstream_response_time"`, request + ` "-"`, 0, false},
+		{`"$request" $status $bytes_sent`, request, 0, false},
+	}
+
+	for _, tt := range tests {
+		r := NewEntry(gonx.NewParser(tt.format))
+		if err := r.ParseLine(tt.line); err != nil {
+			t.Fatalf("ParseEntry should not fail. Error: %+v", err)
+		}
+		if r.HasLatency != tt.has || (r.Latency-tt.latency).Abs() > time.Microsecond {
+			t.Errorf("%s: expected latency %s (%v), got %s (%v)", tt.line, tt.latency, tt.has, r.Latency, r.HasLatency)
+		}
+	}
+
+	// Malformed and implausible request times leave the entry without latency.
+	for _, v := range []string{"fast", "1e300", "+Inf", "NaN", "-1"} {
+		r := NewEntry(gonx.NewParser(`"$request" $status $bytes_sent $request_time`))
+		if err := r.ParseLine(request + " " + v); err != nil || r.HasLatency || r.Latency != 0 {
+			t.Errorf("%s: expected an entry without latency, got %s (%v), %v", v, r.Latency, r.HasLatency, err)
+		}
+	}
+}
+
+func TestLogsLatency(t *testing.T) {
+	tests := map[string]bool{
+		parserFormat:                               false,
+		parserFormat + " $request_time":            true,
+		parserFormat + " $request_time_us":         true,
+		"$upstream_response_time $request $status": true,
+	}
+
+	for format, expected := range tests {
+		if actual := logsLatency(format); actual != expected {
+			t.Errorf("logsLatency(%q): expected %v, got %v", format, expected, actual)
+		}
+	}
 }
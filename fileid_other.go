@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// fileID is not supported, read offsets are not resumed.
+func fileID(fi os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
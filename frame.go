@@ -2,55 +2,147 @@ package main
 
 import (
 	"math"
+	"time"
 )
 
 // Frame provides data collected and processed during one poll interval.
+// Points are time buckets of Res length, a point holds hits read during its bucket.
+// Points are kept in a ring buffer, so recording one takes constant time and memory.
 type Frame struct {
-	PointHits  []int // timeline of hits per each point during MTF
-	AvgTraffic int
+	AvgTraffic float64 // hits per second
 	PointsQty  int
+	Res        time.Duration // bucket length, the poll interval
+	Windows    []*Window     // rolling windows, ex. 1, 5 and 15 minutes, optional
+
+	points ring      // timeline of hits per each point during MTF
+	start  time.Time // time of the first recorded bucket
+	last   int64     // index of the last recorded bucket since start
 }
 
 // NewFrame returns a new Frame with a pre-calculated quantity of points per frame.
-func NewFrame(mtf, pollInt int) *Frame {
+func NewFrame(mtf, pollInt time.Duration) *Frame {
 
-	// We monitor last "mtf" seconds of traffic
-	// and checking this time window every pollInt seconds, i.e.
+	// We monitor last "mtf" of traffic
+	// and checking this time window every pollInt, i.e.
 	// we need to store floor(mtf/pollInt) points.
+	qty := calcPointsPerFrame(mtf, pollInt)
 	return &Frame{
-		PointsQty: calcPointsPerFrame(mtf, pollInt),
+		PointsQty: qty,
+		Res:       pollInt,
+		points:    newRing(qty),
+	}
+}
+
+// Points returns a copy of the timeline, oldest point first.
+func (f *Frame) Points() []int {
+	out := make([]int, 0, f.points.filled)
+	f.Each(func(v int) {
+		out = append(out, v)
+	})
+	return out
+}
+
+// Each calls fn for every point of the timeline, oldest first.
+func (f *Frame) Each(fn func(v int)) {
+	f.points.each(fn)
+}
+
+// AddWindows adds rolling windows of given lengths fed with the same points.
+func (f *Frame) AddWindows(lens []time.Duration) {
+	for _, l := range lens {
+		f.Windows = append(f.Windows, NewWindow(l, f.Res))
 	}
 }
 
-// Rec adds quantity of hits for one point.
-func (f *Frame) Rec(qty int) {
-	f.PointHits = append(f.PointHits, qty)
-	if len(f.PointHits) > f.PointsQty {
-		// remove 1 element from its head to keep the frame length consistent
-		f.PointHits = f.PointHits[1:]
+// Rates returns rolling rates of all windows.
+func (f *Frame) Rates() []WindowRate {
+	if len(f.Windows) == 0 {
+		return nil
+	}
+
+	out := make([]WindowRate, len(f.Windows))
+	for i, w := range f.Windows {
+		out[i] = WindowRate{Window: windowName(w.Len), Rate: w.Rate()}
+	}
+	return out
+}
+
+// Rec adds quantity of hits for the bucket of time t.
+// Buckets are counted from the first one, so a late poll does not shift the timeline:
+// skipped buckets are recorded as zero points and hits of the same bucket are added up.
+func (f *Frame) Rec(t time.Time, qty int) {
+	if f.start.IsZero() {
+		f.start = t
+		f.points.add(qty)
+		for _, w := range f.Windows {
+			w.Add(qty)
+		}
+		f.recalcAvgTraffic()
+		return
+	}
+
+	// Rounding tolerates ticker jitter up to a half of the bucket.
+	n := int64(math.Floor(float64(t.Sub(f.start))/float64(f.Res) + 0.5))
+
+	gap := n - f.last
+	if gap <= 0 {
+		f.points.addLast(qty)
+		for _, w := range f.Windows {
+			w.AddLast(qty)
+		}
+	} else {
+		f.points.skip(gap - 1)
+		f.points.add(qty)
+		for _, w := range f.Windows {
+			w.Skip(gap - 1)
+			w.Add(qty)
+		}
+		f.last = n
 	}
 
 	f.recalcAvgTraffic()
 }
 
+// Restore replaces points with previously recorded ones, oldest first.
+// Points recorded next continue the timeline from the first of them.
+// Windows are expected to be empty, restored points are added to them.
+func (f *Frame) Restore(points []int) {
+	if len(points) > f.PointsQty {
+		points = points[len(points)-f.PointsQty:]
+	}
+
+	for _, w := range f.Windows {
+		for _, p := range points {
+			w.Add(p)
+		}
+	}
+
+	f.points.reset()
+	for _, p := range points {
+		f.points.add(p)
+	}
+	f.start = time.Time{}
+	f.last = 0
+	f.recalcAvgTraffic()
+}
+
 // recalcAvgTraffic calculates average traffic volume based on accumulated traffic levels
 // for each poll during the user-defined attention span.
 func (f *Frame) recalcAvgTraffic() {
-	sum := 0
-	for _, p := range f.PointHits {
-		sum += p
-	}
-
-	f.AvgTraffic = calcAvgTraffic(sum, f.PointsQty)
+	// During warm-up the frame is not filled yet, the average is over points recorded so far.
+	f.AvgTraffic = calcAvgTraffic(f.points.sum, f.points.filled, f.Res)
 }
 
-// calcAvgTraffic calculates average traffic level per point. Rounded down to nearest int.
-func calcAvgTraffic(total, points int) int {
-	return int(math.Ceil(float64(total / points)))
+// calcAvgTraffic calculates average traffic level per second over points of res length.
+func calcAvgTraffic(total, points int, res time.Duration) float64 {
+	if points == 0 {
+		return 0
+	}
+	return float64(total) / (float64(points) * res.Seconds())
 }
 
 // calcPointsPerFrame calculates amount of points we need to store for current time frame.
 // Based on user configuration. Rounded down to nearest int.
-func calcPointsPerFrame(mtf, pollInt int) int {
-	return int(math.Floor(float64(mtf / pollInt)))
+func calcPointsPerFrame(mtf, pollInt time.Duration) int {
+	return int(mtf / pollInt)
 }
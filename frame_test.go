@@ -3,15 +3,18 @@ package main
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewFrame(t *testing.T) {
 
 	expected := &Frame{
 		PointsQty: 2,
+		Res:       2 * time.Second,
+		points:    newRing(2),
 	}
 
-	actual := NewFrame(5, 2)
+	actual := NewFrame(5*time.Second, 2*time.Second)
 
 	if !reflect.DeepEqual(expected, actual) {
 		t.Error("Failed GetTopHits test!")
@@ -24,15 +27,15 @@ func TestNewFrame(t *testing.T) {
 }
 
 func TestFrame_Rec(t *testing.T) {
-	f := NewFrame(6, 2) // frame of 3 items
-	f.Rec(6)            // should be removed
-	f.Rec(5)
-	f.Rec(2)
-	f.Rec(1)
+	f := NewFrame(6*time.Second, 2*time.Second) // frame of 3 items
+	f.Rec(at(0), 6)                             // should be removed
+	f.Rec(at(2), 5)
+	f.Rec(at(4), 2)
+	f.Rec(at(6), 1)
 
 	expected := []int{5, 2, 1}
 
-	actual := f.PointHits
+	actual := f.Points()
 
 	if !reflect.DeepEqual(expected, actual) {
 		t.Error("Failed GetTopHits test!")
@@ -46,16 +49,103 @@ func TestFrame_Rec(t *testing.T) {
 }
 
 func TestFrame_recalcAvgTraffic(t *testing.T) {
-	f := NewFrame(6, 2) // frame of 3 items
-	f.Rec(6)            // should be removed
-	f.Rec(5)
-	f.Rec(2)
-	f.Rec(1)
+	f := NewFrame(6*time.Second, 2*time.Second) // frame of 3 items
+	f.Rec(at(0), 6)                             // should be removed
+	f.Rec(at(2), 5)
+	f.Rec(at(4), 2)
+	f.Rec(at(6), 1)
 
-	expected := 2 // floor( ( 5+2+1 ) / 3 )
+	expected := 8.0 / 6 // ( 5+2+1 ) / ( 3 * 2s )
 	actual := f.AvgTraffic
 
 	if expected != actual {
-		t.Errorf("TestFrame_recalcAvgTraffic / (%d, %d): expected %d, actual %d", 6, 2, expected, actual)
+		t.Errorf("TestFrame_recalcAvgTraffic / (%d, %d): expected %v, actual %v", 6, 2, expected, actual)
 	}
 }
+
+func TestFrame_Restore(t *testing.T) {
+	f := NewFrame(6*time.Second, 2*time.Second) // frame of 3 items
+	f.Restore([]int{9, 6, 3, 3})
+
+	expected := []int{6, 3, 3}
+	if !reflect.DeepEqual(expected, f.Points()) || f.AvgTraffic != 2 {
+		t.Errorf("Expected points %v with average %d, got %v with %v", expected, 2, f.Points(), f.AvgTraffic)
+	}
+}
+
+func TestFrame_RecBuckets(t *testing.T) {
+	f := NewFrame(time.Second, 250*time.Millisecond) // frame of 4 items
+	f.Rec(at(0), 1)                                  // should be removed
+	f.Rec(at(0.24), 2)                               // early tick, the next bucket
+	f.Rec(at(0.3), 3)                                // the same bucket, hits are added up
+	f.Rec(at(1), 4)                                  // two buckets skipped
+
+	expected := []int{5, 0, 0, 4}
+	if !reflect.DeepEqual(expected, f.Points()) {
+		t.Errorf("Expected points %v, got %v", expected, f.Points())
+	}
+
+	// Averages are hits per second regardless of the bucket length: 9 hits in 1 second.
+	if f.AvgTraffic != 9 {
+		t.Errorf("Expected average %d, got %v", 9, f.AvgTraffic)
+	}
+}
+
+// at returns a time sec seconds after a fixed start.
+func at(sec float64) time.Time {
+	return time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC).Add(time.Duration(sec * float64(time.Second)))
+}
+
+func TestFrame_WarmUp(t *testing.T) {
+	f := NewFrame(4*time.Second, 500*time.Millisecond) // frame of 8 items
+	f.Rec(at(0), 1)
+	f.Rec(at(0.5), 0)
+
+	// 1 hit in the first second, not in the whole frame.
+	if f.AvgTraffic != 1 {
+		t.Errorf("Expected average %v during warm-up, got %v", 1, f.AvgTraffic)
+	}
+
+	// Rates below 1 hit/s are not lost.
+	f.Rec(at(1), 0)
+	f.Rec(at(1.5), 0)
+	if f.AvgTraffic != 0.5 {
+		t.Errorf("Expected average %v, got %v", 0.5, f.AvgTraffic)
+	}
+}
+
+func TestFrame_Each(t *testing.T) {
+	f := NewFrame(3*time.Second, time.Second) // frame of 3 items
+	for i := 0; i < 5; i++ {
+		f.Rec(at(float64(i)), i+1)
+	}
+
+	var actual []int
+	f.Each(func(v int) {
+		actual = append(actual, v)
+	})
+
+	if expected := []int{3, 4, 5}; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected points %v oldest first, got %v", expected, actual)
+	}
+}
+
+func benchmarkFrameRec(b *testing.B, points int) {
+	f := NewFrame(time.Duration(points)*time.Second, time.Second)
+	f.AddWindows([]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute})
+	t := at(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Rec(t.Add(time.Duration(i)*time.Second), i%10)
+	}
+}
+
+func BenchmarkFrame_Rec100(b *testing.B) {
+	benchmarkFrameRec(b, 100)
+}
+
+func BenchmarkFrame_Rec10k(b *testing.B) {
+	benchmarkFrameRec(b, 10000)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defGraphitePrefix = "traffic_monitor"
+	graphiteTimeout   = 5 * time.Second
+)
+
+// GraphiteSink writes samples in Graphite plaintext protocol over TCP.
+// Paths are built as <prefix>.<kind>.<metric>, ex. traffic_monitor.poll.section.shuttle.
+// Connection is (re)established on demand, so a restarted Carbon server is picked up.
+type GraphiteSink struct {
+	addr   string
+	conn   net.Conn
+	prefix string
+}
+
+// NewGraphiteSink returns a Graphite sink sending metrics to addr.
+func NewGraphiteSink(addr, prefix string) *GraphiteSink {
+	if prefix == "" {
+		prefix = defGraphitePrefix
+	}
+
+	return &GraphiteSink{
+		addr:   addr,
+		prefix: strings.TrimSuffix(prefix, "."),
+	}
+}
+
+// Send writes sample metrics, one line per metric.
+func (s *GraphiteSink) Send(smp *Sample) error {
+	var b bytes.Buffer
+	ts := smp.Time.Unix()
+	p := s.prefix + "." + smp.Kind
+
+	fmt.Fprintf(&b, "%s.hits %d %d\n", p, smp.Tally.Hits, ts)
+	fmt.Fprintf(&b, "%s.bytes %d %d\n", p, smp.Tally.Bytes, ts)
+	fmt.Fprintf(&b, "%s.avg_traffic %s %d\n", p, formatFloat(smp.AvgTraffic), ts)
+
+	for _, g := range []uint8{2, 3, 4, 5} {
+		fmt.Fprintf(&b, "%s.status.%dxx %d %d\n", p, g, smp.Tally.StatusCodes[g], ts)
+	}
+
+	for _, k := range sortedCounts(smp.Tally.Methods) {
+		fmt.Fprintf(&b, "%s.method.%s %d %d\n", p, namePart(k), smp.Tally.Methods[k], ts)
+	}
+
+	for _, k := range sortedCounts(smp.Tally.Sections) {
+		fmt.Fprintf(&b, "%s.section.%s %d %d\n", p, namePart(k), smp.Tally.Sections[k], ts)
+	}
+
+	for _, k := range sortedKeys(smp.States) {
+		fmt.Fprintf(&b, "%s.alert.%s %d %d\n", p, namePart(k), smp.States[k], ts)
+	}
+
+	return s.write(b.Bytes())
+}
+
+// Close closes current connection, if any.
+func (s *GraphiteSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// write sends data connecting first if required.
+// Connection is dropped on a failure to be re-established by the next write.
+func (s *GraphiteSink) write(b []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, graphiteTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+
+	if _, err := s.conn.Write(b); err != nil {
+		s.Close()
+		return err
+	}
+
+	return nil
+}
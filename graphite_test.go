@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestGraphiteSink_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err.Error())
+	}
+	defer ln.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+
+	sink := NewGraphiteSink(ln.Addr().String(), "")
+
+	err = sink.Send(testSample(sampleKindPoll))
+	if err != nil {
+		t.Fatalf("Send should not fail. Error: %+v", err)
+	}
+	sink.Close()
+
+	expected := `traffic_monitor.poll.hits 3 1500000000
+traffic_monitor.poll.bytes 1500 1500000000
+traffic_monitor.poll.avg_traffic 4 1500000000
+traffic_monitor.poll.status.2xx 2 1500000000
+traffic_monitor.poll.status.3xx 0 1500000000
+traffic_monitor.poll.status.4xx 0 1500000000
+traffic_monitor.poll.status.5xx 1 1500000000
+traffic_monitor.poll.method.GET 3 1500000000
+traffic_monitor.poll.section.my_images 1 1500000000
+traffic_monitor.poll.section.shuttle 2 1500000000
+traffic_monitor.poll.alert.traffic 0 1500000000
+`
+	actual := string(<-received)
+
+	if expected != actual {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defHistoryRetention = time.Hour
+)
+
+// Alert transition types.
+const (
+	alertEscalation   = "escalation"
+	alertDeescalation = "deescalation"
+)
+
+// alertRecord is one alert state transition of a rule.
+type alertRecord struct {
+	Rule    string    `json:"rule"`
+	Type    string    `json:"type"` // alert*
+	Time    time.Time `json:"time"`
+	Traffic float64   `json:"traffic"`
+}
+
+// ruleState is current state of an alert rule.
+type ruleState struct {
+	State uint8     `json:"-"`
+	Name  string    `json:"state"` // ok or alert
+	Since time.Time `json:"since"` // time of the last transition, zero if none
+}
+
+// History is a sink keeping poll samples for a retention period and all alert transitions,
+// so recent statistics can be queried at any time.
+type History struct {
+	HeavyHitters int // capacity of section sketches of merged windows, 0 - exact counts
+	MaxKeys      int // distinct keys of merged windows, 0 - no limit
+
+	mu        sync.RWMutex
+	alerts    []alertRecord
+	pollInt   time.Duration
+	retention time.Duration
+	samples   []*Sample // oldest first
+	states    map[string]*ruleState
+}
+
+// NewHistory returns an empty History.
+func NewHistory(pollInt, retention time.Duration) *History {
+	return &History{
+		pollInt:   pollInt,
+		retention: retention,
+		states:    make(map[string]*ruleState),
+	}
+}
+
+// Send records a poll sample and alert state changes.
+func (h *History) Send(smp *Sample) error {
+	if smp.Kind != sampleKindPoll {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, smp)
+
+	// Drop samples out of retention.
+	cut := 0
+	for cut < len(h.samples) && smp.Time.Sub(h.samples[cut].Time) >= h.retention {
+		cut++
+	}
+	if cut > 0 {
+		h.samples = append([]*Sample(nil), h.samples[cut:]...)
+	}
+
+	for rule, st := range smp.States {
+		// Rules start in the OK state, same as the session.
+		cur, ok := h.states[rule]
+		if !ok {
+			cur = &ruleState{State: stateOK, Name: stateName(stateOK)}
+			h.states[rule] = cur
+		}
+
+		if cur.State == st {
+			continue
+		}
+
+		typ := alertEscalation
+		if st == stateOK {
+			typ = alertDeescalation
+		}
+
+		cur.State = st
+		cur.Name = stateName(st)
+		cur.Since = smp.Time
+
+		h.alerts = append(h.alerts, alertRecord{
+			Rule:    rule,
+			Type:    typ,
+			Time:    smp.Time,
+			Traffic: smp.AvgTraffic,
+		})
+	}
+
+	return nil
+}
+
+// Window returns a tally of all samples not older than d
+// and the time span the tally actually covers.
+// The tally is bounded the same way as tallies of the session.
+func (h *History) Window(d time.Duration) (*Tally, time.Duration) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := NewTally()
+	out.MaxKeys = h.MaxKeys
+	if h.HeavyHitters > 0 {
+		out.Top = NewTopK(h.HeavyHitters)
+		out.TopBytes = NewTopK(h.HeavyHitters)
+	}
+	if len(h.samples) == 0 {
+		return out, 0
+	}
+
+	last := h.samples[len(h.samples)-1].Time
+	polls := 0
+
+	for i := len(h.samples) - 1; i >= 0; i-- {
+		smp := h.samples[i]
+		if last.Sub(smp.Time) >= d {
+			break
+		}
+
+		out.Merge(smp.Tally)
+		polls++
+	}
+
+	return out, time.Duration(polls) * h.pollInt
+}
+
+// Last returns the most recent sample or nil.
+func (h *History) Last() *Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.samples) == 0 {
+		return nil
+	}
+	return h.samples[len(h.samples)-1]
+}
+
+// Alerts returns alert transitions and current state per rule.
+func (h *History) Alerts() ([]alertRecord, map[string]ruleState) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	states := make(map[string]ruleState, len(h.states))
+	for k, v := range h.states {
+		states[k] = *v
+	}
+
+	return append([]alertRecord(nil), h.alerts...), states
+}
+
+// stateName returns a readable name of a state.
+func stateName(st uint8) string {
+	if st == stateAlert {
+		return "alert"
+	}
+	return "ok"
+}
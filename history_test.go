@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory_Send(t *testing.T) {
+	h := NewHistory(time.Second, 3*time.Second)
+	start := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	states := []uint8{stateOK, stateAlert, stateAlert, stateOK, stateOK}
+	for i, st := range states {
+		h.Send(&Sample{
+			AvgTraffic: float64(i),
+			Kind:       sampleKindPoll,
+			States:     map[string]uint8{ruleTraffic: st},
+			Tally:      &Tally{Hits: i + 1, Sections: map[string]int{"/shuttle": i + 1}},
+			Time:       start.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	// Report samples are ignored.
+	h.Send(&Sample{Kind: sampleKindReport, Tally: &Tally{Hits: 100}, Time: start.Add(5 * time.Second)})
+
+	// Retention keeps 3 last polls: 3 + 4 + 5 hits.
+	tl, covered := h.Window(time.Hour)
+	if tl.Hits != 12 || covered != 3*time.Second {
+		t.Errorf("Expected %d hits over %s, got %d over %s", 12, 3*time.Second, tl.Hits, covered)
+	}
+
+	tl, covered = h.Window(2 * time.Second)
+	if tl.Hits != 9 || tl.Sections["/shuttle"] != 9 || covered != 2*time.Second {
+		t.Errorf("Expected %d hits over %s, got %d over %s", 9, 2*time.Second, tl.Hits, covered)
+	}
+
+	alerts, rules := h.Alerts()
+	if len(alerts) != 2 {
+		t.Fatalf("Expected %d alert records, got %d: %+v", 2, len(alerts), alerts)
+	}
+
+	if alerts[0].Type != alertEscalation || !alerts[0].Time.Equal(start.Add(time.Second)) || alerts[0].Traffic != 1 {
+		t.Errorf("Unexpected escalation record %+v", alerts[0])
+	}
+
+	if alerts[1].Type != alertDeescalation || !alerts[1].Time.Equal(start.Add(3*time.Second)) {
+		t.Errorf("Unexpected deescalation record %+v", alerts[1])
+	}
+
+	if r := rules[ruleTraffic]; r.Name != "ok" || !r.Since.Equal(start.Add(3*time.Second)) {
+		t.Errorf("Unexpected rule state %+v", r)
+	}
+}
+
+func TestHistory_WindowHeavyHitters(t *testing.T) {
+	h := NewHistory(time.Second, time.Hour)
+	h.HeavyHitters = 2
+	start := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	for i, section := range []string{"/a", "/b", "/c"} {
+		poll := NewTally()
+		poll.Top = NewTopK(2)
+		poll.Add(&Entry{Section: "/shuttle", StatusCode: "200"})
+		poll.Add(&Entry{Section: "/shuttle", StatusCode: "200"})
+		poll.Add(&Entry{Section: section, StatusCode: "200"})
+		poll.Top.AddErr("/shuttle", 1)
+
+		h.Send(&Sample{Kind: sampleKindPoll, Tally: poll, Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	tl, _ := h.Window(time.Hour)
+	if len(tl.Sections) != 2 || tl.Sections["/shuttle"] != 6 {
+		t.Errorf("Expected 2 sections with /shuttle counted 6 times, got %v", tl.Sections)
+	}
+
+	// Error bounds of the samples are carried into the window.
+	if err := tl.Top.Err("/shuttle"); err != 3 {
+		t.Errorf("Expected error bound %d, got %d", 3, err)
+	}
+}
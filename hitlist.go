@@ -6,8 +6,8 @@ import (
 
 // Pair is a k/v bucket for HitList.
 type Pair struct {
-	Key   string
-	Value int
+	Key   string `json:"key"`
+	Value int    `json:"value"`
 }
 
 // HitList is a map for sorted data with struct value types.
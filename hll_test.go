@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHLL_Count(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := NewHLL(hllPrecision)
+		for i := 0; i < n; i++ {
+			ip := "10." + strconv.Itoa(i>>16&255) + "." + strconv.Itoa(i>>8&255) + "." + strconv.Itoa(i&255)
+			h.Add(ip)
+			h.Add(ip) // repeated visits are not counted
+		}
+
+		// Within 3 standard errors.
+		if actual := h.Count(); math.Abs(float64(actual-n)) > 3*0.0082*float64(n)+1 {
+			t.Errorf("Expected about %d distinct values, got %d", n, actual)
+		}
+	}
+}
+
+func TestHLL_Merge(t *testing.T) {
+	a, b := NewHLL(hllSectionPrecision), NewHLL(hllSectionPrecision)
+	for i := 0; i < 500; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 250))
+	}
+	a.Merge(b)
+
+	if actual := a.Count(); math.Abs(float64(actual-750)) > 3*0.033*750 {
+		t.Errorf("Expected about %d distinct values, got %d", 750, actual)
+	}
+}
+
+func TestVisitorWindow(t *testing.T) {
+	w := NewVisitorWindow(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		h := NewHLL(hllWindowPrecision)
+		h.Add("10.0.0." + strconv.Itoa(i))
+		h.Add("10.0.0.100")
+		w.Add(at(float64(i*20)), h)
+	}
+
+	if actual := w.Count(); actual != 4 {
+		t.Errorf("Expected %d visitors, got %d", 4, actual)
+	}
+
+	// Buckets older than a minute leave the window.
+	w.Add(at(90), nil)
+	if actual := w.Count(); actual != 2 {
+		t.Errorf("Expected %d visitors of the last bucket, got %d", 2, actual)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Events buffered per subscriber, a slow client misses events above that.
+	hubSubBuffer = 64
+)
+
+// event is a JSON representation of a monitor message.
+type event struct {
+	Type      string       `json:"type"`
+	Time      time.Time    `json:"time"`
+	Body      string       `json:"body,omitempty"`
+	Metric    string       `json:"metric,omitempty"`
+	Points    []int        `json:"points,omitempty"`
+	Rates     []WindowRate `json:"rates,omitempty"` // rolling rates of a point
+	Report    *reportEvent `json:"report,omitempty"`
+	Rule      string       `json:"rule,omitempty"` // empty for the built-in traffic rule
+	Threshold float64      `json:"threshold,omitempty"`
+	Traffic   float64      `json:"traffic"`
+}
+
+// reportEvent is a JSON representation of a Report.
+type reportEvent struct {
+	Latency            *LatencyStats            `json:"latency,omitempty"`        // nil if latency is not logged
+	SectionLatency     map[string]*LatencyStats `json:"sectionLatency,omitempty"` // latency of top sections
+	Bytes              int64                    `json:"bytes"`
+	MaxBytes           int64                    `json:"maxBytes"`                     // largest response
+	SectionBytes       []Pair                   `json:"sectionBytes"`                 // top sections by bytes sent
+	SectionErrors      map[string]int           `json:"sectionErrors,omitempty"`      // heavy hitters mode: maximum overestimation of section counts
+	SectionBytesErrors map[string]int           `json:"sectionBytesErrors,omitempty"` // heavy hitters mode: maximum overestimation of section bytes
+	SectionVisitors    map[string]int           `json:"sectionVisitors,omitempty"`    // estimated distinct visitors of top sections
+	Sections           []Pair                   `json:"sections"`                     // top sections, most visited first
+	Sources            map[string]int           `json:"sources,omitempty"`            // hits by log file or syslog host
+	StatusCodes        map[string]int           `json:"statusCodes"`
+	TotalHits          int                      `json:"totalHits"`
+	Visitors           int                      `json:"visitors,omitempty"` // estimated distinct visitors
+}
+
+// Hub fans monitor messages out to subscribers, ex. web dashboard clients,
+// and keeps what a new subscriber needs to catch up: full alert history, last point and last report.
+type Hub struct {
+	mu     sync.Mutex
+	alerts []event
+	point  *event
+	report *event
+	subs   map[chan event]struct{}
+}
+
+// NewHub returns an empty Hub.
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[chan event]struct{}),
+	}
+}
+
+// Tee publishes every message from in and passes it on to the returned channel,
+// so the hub can be put between Monitor and Printer.
+func (h *Hub) Tee(in <-chan msg) <-chan msg {
+	out := make(chan msg)
+
+	go func() {
+		for m := range in {
+			h.Publish(m)
+			out <- m
+		}
+		close(out)
+	}()
+
+	return out
+}
+
+// Publish records a message and sends it to all subscribers.
+func (h *Hub) Publish(m msg) {
+	e := newEvent(m)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch m.msgType {
+	case msgTypeAlertEsc, msgTypeAlertDeesc:
+		h.alerts = append(h.alerts, e)
+	case msgTypePoint:
+		h.point = &e
+	case msgTypeReport:
+		h.report = &e
+	}
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			// Subscriber is too slow, drop the event rather than block the monitor.
+		}
+	}
+}
+
+// Subscribe registers a new subscriber returning its channel
+// and a snapshot of the current state to send first.
+func (h *Hub) Subscribe() (chan event, []event) {
+	ch := make(chan event, hubSubBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subs[ch] = struct{}{}
+
+	snap := append([]event(nil), h.alerts...)
+	if h.report != nil {
+		snap = append(snap, *h.report)
+	}
+	if h.point != nil {
+		snap = append(snap, *h.point)
+	}
+
+	return ch, snap
+}
+
+// Unsubscribe removes a subscriber.
+func (h *Hub) Unsubscribe(ch chan event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, ch)
+}
+
+// Alerts returns a copy of the alert history.
+func (h *Hub) Alerts() []event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]event(nil), h.alerts...)
+}
+
+// newEvent converts a message into an event.
+func newEvent(m msg) event {
+	e := event{
+		Type:      m.msgType,
+		Time:      m.time,
+		Body:      m.body,
+		Metric:    m.metric,
+		Points:    m.points,
+		Rates:     m.rates,
+		Rule:      m.rule,
+		Threshold: m.threshold,
+		Traffic:   m.traffic,
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if m.report != nil {
+		r := &reportEvent{
+			Latency:            m.report.Latency,
+			SectionLatency:     m.report.SectionLatency,
+			SectionBytes:       make([]Pair, len(m.report.TopSectionBytes)),
+			SectionErrors:      m.report.SectionErrors,
+			SectionBytesErrors: m.report.SectionBytesErrors,
+			SectionVisitors:    m.report.SectionVisitors,
+			Visitors:           m.report.Visitors,
+			Sections:           make([]Pair, len(m.report.TopSectionHits)),
+			StatusCodes:        make(map[string]int),
+			TotalHits:          m.report.TotalHits,
+		}
+		for i := 0; i < len(m.report.TopSectionHits); i++ {
+			r.Sections[i] = m.report.TopSectionHits[i]
+		}
+		for i := 0; i < len(m.report.TopSectionBytes); i++ {
+			r.SectionBytes[i] = m.report.TopSectionBytes[i]
+		}
+		if m.report.Tally != nil {
+			r.Bytes = m.report.Tally.Bytes
+			r.MaxBytes = m.report.Tally.MaxBytes
+		}
+		for src, t := range m.report.Sources {
+			if r.Sources == nil {
+				r.Sources = make(map[string]int)
+			}
+			r.Sources[src] = t.Hits
+		}
+		for g, v := range m.report.StatusCodes {
+			r.StatusCodes[strconv.Itoa(int(g))+"xx"] = v
+		}
+		if m.report.Time != nil {
+			e.Time = *m.report.Time
+		}
+		e.Report = r
+	}
+
+	return e
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHub_Subscribe(t *testing.T) {
+	h := NewHub()
+	at := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	h.Publish(msgAlertEsc(3, at))
+	h.Publish(msgPoint(3, 2, []int{3}, nil))
+	h.Publish(msgAlertDeesc(1, at.Add(time.Minute)))
+	h.Publish(msgPoint(1, 2, []int{3, 0}, nil))
+
+	ch, snap := h.Subscribe()
+	defer h.Unsubscribe(ch)
+
+	// Alert history first, then the latest point.
+	expected := []string{msgTypeAlertEsc, msgTypeAlertDeesc, msgTypePoint}
+	if len(snap) != len(expected) {
+		t.Fatalf("Expected %d snapshot events, got %d: %+v", len(expected), len(snap), snap)
+	}
+	for i, e := range snap {
+		if e.Type != expected[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, expected[i], e.Type)
+		}
+	}
+	if snap[2].Traffic != 1 {
+		t.Errorf("Expected latest point traffic %d, got %v", 1, snap[2].Traffic)
+	}
+
+	h.Publish(msgErr(errTest))
+
+	select {
+	case e := <-ch:
+		if e.Type != msgTypeError || e.Body != errTest.Error() {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("Subscriber should receive published events")
+	}
+}
+
+func TestHub_Tee(t *testing.T) {
+	h := NewHub()
+	in := make(chan msg)
+	out := h.Tee(in)
+
+	go func() {
+		in <- msgAlertEsc(3, time.Now())
+		close(in)
+	}()
+
+	m := <-out
+	if m.msgType != msgTypeAlertEsc {
+		t.Errorf("Expected %s message, got %s", msgTypeAlertEsc, m.msgType)
+	}
+
+	if _, ok := <-out; ok {
+		t.Error("Output should be closed after input")
+	}
+
+	if n := len(h.Alerts()); n != 1 {
+		t.Errorf("Expected %d alert recorded, got %d", 1, n)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defInfluxMeasurement = "traffic"
+	influxTimeout        = 5 * time.Second
+)
+
+// InfluxSink writes samples in InfluxDB line protocol to an HTTP write endpoint or a file.
+//
+// Measurements, for a default "traffic" name:
+//
+//	traffic          hits, bytes, avg_traffic
+//	traffic_status   hits by status class
+//	traffic_method   hits by request method
+//	traffic_section  hits by section
+//	traffic_alert    state by alert rule
+//
+// All points are tagged with a sample kind: poll or report.
+type InfluxSink struct {
+	measurement string
+	write       func(b []byte) error
+	close       func() error
+}
+
+// NewInfluxHTTPSink returns a sink posting points to an InfluxDB write endpoint,
+// ex. http://localhost:8086/write?db=traffic or http://localhost:8086/api/v2/write?org=o&bucket=b.
+func NewInfluxHTTPSink(url, measurement string) *InfluxSink {
+	c := &http.Client{Timeout: influxTimeout}
+
+	return &InfluxSink{
+		measurement: influxMeasurement(measurement),
+		write: func(b []byte) error {
+			resp, err := c.Post(url, "text/plain; charset=utf-8", bytes.NewReader(b))
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode/100 != 2 {
+				body, _ := ioutil.ReadAll(resp.Body)
+				return fmt.Errorf("InfluxDB write failed: %s %s", resp.Status, strings.TrimSpace(string(body)))
+			}
+
+			return nil
+		},
+		close: func() error { return nil },
+	}
+}
+
+// NewInfluxFileSink returns a sink appending points to a file.
+func NewInfluxFileSink(path, measurement string) (*InfluxSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InfluxSink{
+		measurement: influxMeasurement(measurement),
+		write: func(b []byte) error {
+			_, err := f.Write(b)
+			return err
+		},
+		close: f.Close,
+	}, nil
+}
+
+// Send writes one batch of points per sample.
+func (s *InfluxSink) Send(smp *Sample) error {
+	var b bytes.Buffer
+	ts := smp.Time.UnixNano()
+	kind := "kind=" + influxEscape(smp.Kind)
+
+	fmt.Fprintf(&b, "%s,%s hits=%di,bytes=%di,avg_traffic=%s %d\n",
+		s.measurement, kind, smp.Tally.Hits, smp.Tally.Bytes, formatFloat(smp.AvgTraffic), ts)
+
+	for _, g := range []uint8{2, 3, 4, 5} {
+		fmt.Fprintf(&b, "%s_status,%s,class=%dxx hits=%di %d\n",
+			s.measurement, kind, g, smp.Tally.StatusCodes[g], ts)
+	}
+
+	for _, k := range sortedCounts(smp.Tally.Methods) {
+		fmt.Fprintf(&b, "%s_method,%s,method=%s hits=%di %d\n",
+			s.measurement, kind, influxEscape(k), smp.Tally.Methods[k], ts)
+	}
+
+	for _, k := range sortedCounts(smp.Tally.Sections) {
+		fmt.Fprintf(&b, "%s_section,%s,section=%s hits=%di %d\n",
+			s.measurement, kind, influxEscape(k), smp.Tally.Sections[k], ts)
+	}
+
+	for _, k := range sortedKeys(smp.States) {
+		fmt.Fprintf(&b, "%s_alert,%s,rule=%s state=%di %d\n",
+			s.measurement, kind, influxEscape(k), smp.States[k], ts)
+	}
+
+	return s.write(b.Bytes())
+}
+
+// Close releases the underlying file, if any.
+func (s *InfluxSink) Close() error {
+	return s.close()
+}
+
+// influxMeasurement returns a measurement name falling back to the default one.
+func influxMeasurement(m string) string {
+	if m == "" {
+		return defInfluxMeasurement
+	}
+	return strings.NewReplacer(",", `\,`, " ", `\ `).Replace(m)
+}
+
+// influxEscape escapes commas, spaces and equal signs in tag values.
+func influxEscape(s string) string {
+	if s == "" {
+		return "-" // empty tag values are not allowed
+	}
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "=", `\=`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func testSample(kind string) *Sample {
+	return &Sample{
+		AvgTraffic: 4,
+		Kind:       kind,
+		States:     map[string]uint8{ruleTraffic: stateOK},
+		Tally: &Tally{
+			Bytes:       1500,
+			Hits:        3,
+			Methods:     map[string]int{"GET": 3},
+			Sections:    map[string]int{"/shuttle": 2, "/my images": 1},
+			StatusCodes: map[uint8]int{2: 2, 5: 1},
+		},
+		Time: time.Unix(1500000000, 0),
+	}
+}
+
+const expectedInfluxReport = `traffic,kind=report hits=3i,bytes=1500i,avg_traffic=4 1500000000000000000
+traffic_status,kind=report,class=2xx hits=2i 1500000000000000000
+traffic_status,kind=report,class=3xx hits=0i 1500000000000000000
+traffic_status,kind=report,class=4xx hits=0i 1500000000000000000
+traffic_status,kind=report,class=5xx hits=1i 1500000000000000000
+traffic_method,kind=report,method=GET hits=3i 1500000000000000000
+traffic_section,kind=report,section=/my\ images hits=1i 1500000000000000000
+traffic_section,kind=report,section=/shuttle hits=2i 1500000000000000000
+traffic_alert,kind=report,rule=traffic state=0i 1500000000000000000
+`
+
+func TestInfluxSink_File(t *testing.T) {
+	tempFile := getTempLoc(".TestInfluxSink_File.lp")
+	defer os.Remove(tempFile)
+
+	sink, err := NewInfluxFileSink(tempFile, "")
+	if err != nil {
+		t.Fatalf("NewInfluxFileSink should not fail. Error: %+v", err)
+	}
+
+	err = sink.Send(testSample(sampleKindReport))
+	if err != nil {
+		t.Fatalf("Send should not fail. Error: %+v", err)
+	}
+	sink.Close()
+
+	actual, err := ioutil.ReadFile(tempFile)
+	if err != nil {
+		t.Fatalf("Cannot read output: %s", err.Error())
+	}
+
+	if expectedInfluxReport != string(actual) {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expectedInfluxReport, actual)
+	}
+}
+
+func TestInfluxSink_HTTP(t *testing.T) {
+	var actual []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink := NewInfluxHTTPSink(srv.URL+"/write?db=traffic", "")
+
+	err := sink.Send(testSample(sampleKindReport))
+	if err != nil {
+		t.Fatalf("Send should not fail. Error: %+v", err)
+	}
+
+	if expectedInfluxReport != string(actual) {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expectedInfluxReport, actual)
+	}
+}
+
+func TestInfluxSink_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	sink := NewInfluxHTTPSink(srv.URL+"/write?db=traffic", "")
+
+	err := sink.Send(testSample(sampleKindPoll))
+	if err == nil {
+		t.Error("Send should fail on a non-2xx response.")
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/satyrius/gonx"
 )
@@ -18,35 +23,218 @@ var (
 	cfg *Config
 )
 
+const (
+	// Exit codes.
+
+	exitOK          = 0
+	exitError       = 1   // failed to start or to flush sinks on shutdown
+	exitConfig      = 2   // invalid configuration
+	exitInterrupted = 130 // interrupted again during shutdown
+)
+
 func main() {
-	cfg = NewConfig()
+	os.Exit(run())
+}
+
+// run starts the monitor and returns an exit code when it is stopped.
+func run() int {
+	var err error
 
-	s := NewSession(cfg.AlertThreshold, cfg.PollInt, gonx.NewParser(parserFormat))
-	err := s.SetLog(cfg.File)
+	cfg, err = NewConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return exitOK
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfig
+	}
+
+	s := NewSession(cfg.AlertThreshold, cfg.PollInt, gonx.NewParser(cfg.LogFormat))
+	s.HeavyHitters = cfg.HeavyHitters
+	s.MaxKeys = cfg.MaxKeys
+	s.Visitors = cfg.Visitors
+	for i := range cfg.Rules {
+		s.Rules = append(s.Rules, &cfg.Rules[i])
+	}
+
+	// Patterns are matched on every poll, so files created later are picked up.
+	for _, path := range cfg.Files {
+		if isGlob(path) {
+			s.Patterns = append(s.Patterns, path)
+			continue
+		}
+
+		err = s.SetLog(path)
+		if err != nil {
+			return fail(err)
+		}
 	}
 	defer s.Close()
 
-	doneChan := make(chan struct{})
+	if cfg.SyslogAddr != "" {
+		src, err := NewSyslogSource(cfg.SyslogAddr)
+		if err != nil {
+			return fail(err)
+		}
+		s.Sources = append(s.Sources, src)
+	}
+
+	if cfg.StateFile != "" {
+		s.Registry, err = NewRegistry(cfg.StateFile)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	// HTTP handlers grouped by listen address, so several features can share one port.
+	muxes := make(map[string]*http.ServeMux)
+
+	if cfg.MetricsAddr != "" {
+		s.Metrics = NewMetrics()
+		s.Metrics.MaxKeys = cfg.MaxKeys
+		muxFor(muxes, cfg.MetricsAddr).Handle(metricsPath, s.Metrics)
+	}
+
+	sinks, err := NewSinks(cfg)
+	if err != nil {
+		return fail(err)
+	}
+
+	reloadChan := make(chan *reloadRequest)
+	s.Reload = reloadChan
+
+	rl := NewReloader(os.Args[1:], cfg, sinks, reloadChan)
+
+	// The dashboard and the API see reloaded settings, ex. top-N.
+	var hub *Hub
+	if cfg.HTTPAddr != "" {
+		hub = NewHub()
+		NewWebUI(rl.Config, hub).Register(muxFor(muxes, cfg.HTTPAddr))
+	}
+
+	if cfg.APIAddr != "" {
+		h := NewHistory(cfg.PollInt, cfg.APIRetention)
+		h.HeavyHitters = cfg.HeavyHitters
+		h.MaxKeys = cfg.MaxKeys
+		s.Sinks = append(s.Sinks, h)
+		NewAPI(rl.Config, h).Register(muxFor(muxes, cfg.APIAddr))
+	}
+
+	s.Sinks = append(s.Sinks, sinks...)
+
+	if cfg.AdminAddr != "" {
+		muxFor(muxes, cfg.AdminAddr).Handle(reloadPath, rl)
+	}
+
+	err = serveHTTP(muxes)
+	if err != nil {
+		closeSinks(s.Sinks)
+		return fail(err)
+	}
+
+	stopChan := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() { close(stopChan) })
+	}
+
 	msgChan := make(chan msg)
 
-	go Monitor(cfg, s, doneChan, msgChan)
+	// Messages reach the printer through the hub when the web dashboard is on.
+	var outChan <-chan msg = msgChan
+	if hub != nil {
+		outChan = hub.Tee(msgChan)
+	}
+
+	var d *Dashboard
+	if cfg.UI == uiTUI {
+		d = NewDashboard(cfg)
+		if err := d.Start(); err != nil {
+			closeSinks(s.Sinks)
+			return fail(err)
+		}
+	}
+
+	// Output handlers return when all messages are handled.
+	outDone := make(chan struct{})
+	go func() {
+		if d != nil {
+			d.Run(stop, outChan)
+		} else {
+			Printer(cfg, outChan)
+		}
+		close(outDone)
+	}()
 
-	go Ctrl(doneChan)
+	go Ctrl(stop, func() { rl.Reload() })
 
-	go Printer(cfg, doneChan, msgChan)
+	err = Monitor(cfg, s, stopChan, msgChan)
+	<-outDone
 
-	<-doneChan
+	if d != nil {
+		d.Stop()
+	}
+
+	if err != nil {
+		return fail(err)
+	}
 
 	fmt.Print("\nMonitor stopped.\n")
+
+	return exitOK
+}
+
+// fail reports an error which stops the monitor and returns an exit code.
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	return exitError
 }
 
-// Ctrl handles monitor shutdown actions.
-func Ctrl(doneChan chan<- struct{}) {
+// Ctrl handles monitor shutdown actions and configuration reloads on SIGHUP, if reload is set.
+// The first interrupt stops the monitor gracefully, the second one exits immediately.
+func Ctrl(stop func(), reload func()) {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, os.Kill)
-	for range sigChan {
-		doneChan <- struct{}{}
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	if reload != nil {
+		signal.Notify(sigChan, syscall.SIGHUP)
+	}
+
+	stopping := false
+	for sig := range sigChan {
+		switch {
+		case sig == syscall.SIGHUP:
+			go reload()
+		case stopping:
+			fmt.Fprintln(os.Stderr, "\nInterrupted during shutdown.")
+			os.Exit(exitInterrupted)
+		default:
+			stopping = true
+			stop()
+		}
+	}
+}
+
+// muxFor returns a mux serving addr, creating it if required.
+func muxFor(muxes map[string]*http.ServeMux, addr string) *http.ServeMux {
+	mux, ok := muxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		muxes[addr] = mux
 	}
+	return mux
+}
+
+// serveHTTP starts serving every mux on its address in background.
+// Listeners are opened synchronously to fail early on an unavailable address.
+func serveHTTP(muxes map[string]*http.ServeMux) error {
+	for addr, mux := range muxes {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		go http.Serve(ln, mux)
+	}
+
+	return nil
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	metricsPath   = "/metrics"
+	metricsPrefix = "traffic_monitor_"
+)
+
+// Metrics accumulates monitoring data exposed in Prometheus text format.
+// Counters are cumulative for the lifetime of the process,
+// gauges reflect the state at the last poll.
+// So is the MaxKeys limit: once MaxKeys distinct sections have been seen,
+// every new one is counted as otherKey until restart, the same goes for methods and status codes.
+type Metrics struct {
+	MaxKeys int // distinct sections, methods and status codes kept, the rest is counted as otherKey, 0 - no limit
+
+	mu sync.Mutex
+
+	sectionHits map[string]uint64
+	methodHits  map[string]uint64
+	statusHits  map[string]uint64
+	bytesSent   uint64
+	parseErrors uint64
+
+	avgTraffic  float64
+	rates       []WindowRate
+	alertStates map[string]uint8 // rule name -> state*
+	readLag     int64            // bytes written to the log but not read yet
+}
+
+// NewMetrics returns an empty Metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		sectionHits: make(map[string]uint64),
+		methodHits:  make(map[string]uint64),
+		statusHits:  make(map[string]uint64),
+		alertStates: make(map[string]uint8),
+	}
+}
+
+// ObserveEntry registers a successfully parsed log entry.
+func (m *Metrics) ObserveEntry(e *Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.sectionHits[e.Section]
+	m.sectionHits[cappedKey(e.Section, ok, len(m.sectionHits), m.MaxKeys)]++
+	_, ok = m.methodHits[e.Method]
+	m.methodHits[cappedKey(e.Method, ok, len(m.methodHits), m.MaxKeys)]++
+	_, ok = m.statusHits[e.StatusCode]
+	m.statusHits[cappedKey(e.StatusCode, ok, len(m.statusHits), m.MaxKeys)]++
+	m.bytesSent += uint64(e.BytesSent)
+}
+
+// ObserveParseError registers a log line which could not be parsed.
+func (m *Metrics) ObserveParseError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parseErrors++
+}
+
+// SetAvgTraffic sets current average traffic level of the monitoring time frame.
+func (m *Metrics) SetAvgTraffic(v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.avgTraffic = v
+}
+
+// SetRates sets current rolling rates.
+func (m *Metrics) SetRates(rates []WindowRate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rates = rates
+}
+
+// SetAlertState sets current state of an alert rule.
+func (m *Metrics) SetAlertState(rule string, state uint8) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.alertStates[rule] = state
+}
+
+// SetReadLag sets amount of bytes the reader is behind the end of the log file.
+func (m *Metrics) SetReadLag(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.readLag = n
+}
+
+// ServeHTTP writes all metrics in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes all metrics in Prometheus text exposition format to w.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeCounterVec(&b, "section_hits_total", "Hits by site section.", "section", m.sectionHits)
+	writeCounterVec(&b, "method_hits_total", "Hits by request method.", "method", m.methodHits)
+	writeCounterVec(&b, "status_hits_total", "Hits by response status code.", "code", m.statusHits)
+
+	writeHeader(&b, "bytes_sent_total", "Total size of response bodies, bytes.", "counter")
+	fmt.Fprintf(&b, "%sbytes_sent_total %d\n", metricsPrefix, m.bytesSent)
+
+	writeHeader(&b, "parse_errors_total", "Log lines which could not be parsed.", "counter")
+	fmt.Fprintf(&b, "%sparse_errors_total %d\n", metricsPrefix, m.parseErrors)
+
+	writeHeader(&b, "avg_traffic", "Average hits per second during the monitoring time frame.", "gauge")
+	fmt.Fprintf(&b, "%savg_traffic %s\n", metricsPrefix, formatFloat(m.avgTraffic))
+
+	if len(m.rates) > 0 {
+		writeHeader(&b, "rate", "Hits per second over rolling windows.", "gauge")
+		for _, r := range m.rates {
+			fmt.Fprintf(&b, "%srate{window=\"%s\"} %s\n", metricsPrefix, r.Window, formatFloat(r.Rate))
+		}
+	}
+
+	writeHeader(&b, "alert_state", "Alert state per rule: 0 - OK, 2 - alert.", "gauge")
+	for _, k := range sortedKeys(m.alertStates) {
+		fmt.Fprintf(&b, "%salert_state{rule=\"%s\"} %d\n", metricsPrefix, escapeLabel(k), m.alertStates[k])
+	}
+
+	writeHeader(&b, "read_lag_bytes", "Bytes written to the log file but not read yet.", "gauge")
+	fmt.Fprintf(&b, "%sread_lag_bytes %d\n", metricsPrefix, m.readLag)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeHeader writes HELP and TYPE lines of a metric.
+func writeHeader(b *strings.Builder, name, help, typ string) {
+	fmt.Fprintf(b, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(b, "# TYPE %s%s %s\n", metricsPrefix, name, typ)
+}
+
+// writeCounterVec writes a counter with one label, samples are sorted by label value.
+func writeCounterVec(b *strings.Builder, name, help, label string, v map[string]uint64) {
+	writeHeader(b, name, help, "counter")
+
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s%s{%s=\"%s\"} %d\n", metricsPrefix, name, label, escapeLabel(k), v[k])
+	}
+}
+
+// sortedKeys returns keys of a state map in alphabetical order.
+func sortedKeys(m map[string]uint8) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeLabel escapes a label value according to the text exposition format.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+
+	s := NewSession(2, time.Second, gonx.NewParser(parserFormat))
+	s.Metrics = NewMetrics()
+
+	err := s.ConsumeLines([]string{
+		`182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/technology/sts-newsref/srb.html HTTP/1.0" 200 49553`,
+		`198.155.12.13 - - [28/Jul/1995:13:17:09 -0400] "POST /images/NASA-logosmall.gif HTTP/1.0" 500 786`,
+		`198.155.12.13 - - [28/Jul/1995:13:17:09 -0400] "GET /images/NASA-logosmall.gif HTTP/1.0" 304 -`,
+	})
+	if err != nil {
+		t.Fatalf("ConsumeLines should not fail. Error: %+v", err)
+	}
+
+	err = s.AddLine("garbage")
+	if err == nil {
+		t.Fatal("AddLine should fail on an invalid line.")
+	}
+
+	s.Metrics.SetAvgTraffic(7)
+	s.Metrics.SetAlertState(ruleTraffic, stateAlert)
+	s.Metrics.SetReadLag(42)
+
+	rec := httptest.NewRecorder()
+	s.Metrics.ServeHTTP(rec, httptest.NewRequest("GET", metricsPath, nil))
+
+	body := rec.Body.String()
+
+	expected := []string{
+		"# TYPE traffic_monitor_section_hits_total counter",
+		`traffic_monitor_section_hits_total{section="/images"} 2`,
+		`traffic_monitor_section_hits_total{section="/shuttle"} 1`,
+		`traffic_monitor_method_hits_total{method="GET"} 2`,
+		`traffic_monitor_method_hits_total{method="POST"} 1`,
+		`traffic_monitor_status_hits_total{code="200"} 1`,
+		`traffic_monitor_status_hits_total{code="304"} 1`,
+		`traffic_monitor_status_hits_total{code="500"} 1`,
+		"traffic_monitor_bytes_sent_total 50339",
+		"traffic_monitor_parse_errors_total 1",
+		"traffic_monitor_avg_traffic 7",
+		`traffic_monitor_alert_state{rule="traffic"} 2`,
+		"traffic_monitor_read_lag_bytes 42",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_MaxKeys(t *testing.T) {
+	m := NewMetrics()
+	m.MaxKeys = 2
+
+	for _, code := range []string{"200", "404", "500", "200"} {
+		m.ObserveEntry(&Entry{Method: "GET", Section: "/", StatusCode: code})
+	}
+
+	expected := map[string]uint64{"200": 2, "404": 1, otherKey: 1}
+	if !reflect.DeepEqual(expected, m.statusHits) {
+		t.Errorf("Expected status hits %v, got %v", expected, m.statusHits)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+
+	expected := `/a\"b\\c\n`
+	actual := escapeLabel("/a\"b\\c\n")
+
+	if expected != actual {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
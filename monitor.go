@@ -1,71 +1,325 @@
 package main
 
 import (
-	"bufio"
+	"fmt"
+	"io"
 	"time"
 )
 
-// Monitor is a monitoring routine that tracks changes to a log file,
+const (
+	shutdownTimeout = 5 * time.Second // time given to sinks to flush on shutdown
+)
+
+// Monitor is a monitoring routine that tracks changes to log files,
 // calculates metrics based on accumulated data
 // and issues messages based on changes to a log file and/or metrics.
-func Monitor(cfg *Config, s *Session, doneChan chan struct{}, msgChan chan<- msg) {
+//
+// Monitor runs until MaxPolls polls are made or stopChan is closed and then shuts down in order:
+// sources are read one last time, a final partial report and a summary of open alerts are sent,
+// sinks are flushed and closed within shutdownTimeout and msgChan is closed.
+// An error is returned if sinks fail to flush.
+func Monitor(cfg *Config, s *Session, stopChan <-chan struct{}, msgChan chan<- msg) error {
+	defer close(msgChan)
 
 	f := NewFrame(cfg.MTF, cfg.PollInt)
-	r := bufio.NewReader(s.File)
+	f.AddWindows(cfg.Windows)
+	frames := make(map[string]*Frame) // per source, alerts are checked with several sources
 
-	stat, err := s.File.Stat()
-	if err != nil {
-		panic(err)
+	var visitors []*VisitorWindow
+	if s.countsVisitors() {
+		for _, w := range cfg.Windows {
+			visitors = append(visitors, NewVisitorWindow(w))
+		}
 	}
 
-	prevSize := stat.Size() // starting file read position
+	var latency []*LatencyWindow
+	if logsLatency(cfg.LogFormat) {
+		for _, w := range cfg.Windows {
+			latency = append(latency, NewLatencyWindow(w))
+		}
+	}
 
-	// Move reader's needle to the position where we stopped reading last time or to the initial position.
-	if _, err := s.File.Seek(prevSize, 0); err != nil {
-		panic(err)
+	// Files matching patterns at startup are read from their end, same as files given by name.
+	if _, err := s.Discover(); err != nil {
+		msgChan <- msgErr(err)
 	}
 
-	// Start tickers
-	tickerPolling := time.NewTicker(time.Second * time.Duration(cfg.PollInt))
-	tickerReporting := time.NewTicker(time.Second * time.Duration(cfg.ReportInt))
+	// Every source has its frame from the start, so its average is right once there are several ones.
+	for _, src := range s.Sources {
+		frames[src.Name()] = NewFrame(cfg.MTF, cfg.PollInt)
+	}
+
+	// Move readers to positions where we stopped reading last time.
+	if s.Registry != nil {
+		for _, src := range s.Sources {
+			fsrc, ok := src.(*FileSource)
+			if !ok {
+				continue
+			}
+
+			stat, err := fsrc.Stat()
+			if err != nil {
+				msgChan <- msgErr(err)
+				continue
+			}
+
+			offset, skipped, note := s.Registry.Resume(fsrc.Name(), stat, cfg.MaxReplay)
+			if note != "" {
+				msgChan <- msgInfo(note)
+			}
+
+			// Replay limit can cut a line, its remainder is dropped.
+			if err := fsrc.SetOffset(offset, skipped); err != nil {
+				msgChan <- msgErr(err)
+			}
+		}
+	}
 
 	polls := 0
 
+	// Writes to log files are picked up as they happen if file events are available,
+	// polls only aggregate what is read in between.
+	var watcher *Watcher
+	var events <-chan struct{}
+
+	if cfg.Watch {
+		w, err := NewWatcher()
+		switch {
+		case err == errWatchUnsupported:
+		case err != nil:
+			msgChan <- msgErr(fmt.Errorf("Log files are read on polls only. %s", err.Error()))
+		default:
+			defer w.Close()
+			for _, path := range watchPaths(s) {
+				if err := w.Add(path); err != nil {
+					msgChan <- msgErr(err)
+				}
+			}
+			watcher, events = w, w.Events()
+		}
+	}
+
+	counts := make(map[string]int) // entries read since the last poll by source
+
+	// read passes entries added to sources since the last read to the session storage
+	// and adds numbers of entries read to counts.
+	read := func() {
+		var lag int64
+
+		for _, src := range s.Sources {
+			if hs, ok := src.(HostSource); ok {
+				hosts, err := hs.ReadHosts()
+				if err != nil {
+					msgChan <- msgErr(err)
+				}
+
+				for host, lines := range hosts {
+					counts[src.Name()] += len(lines)
+					if err := s.ConsumeSourceLines(host, lines); err != nil {
+						msgChan <- msgErr(err)
+					}
+				}
+				continue
+			}
+
+			lines, err := src.Read()
+			if err != nil {
+				msgChan <- msgErr(err)
+			}
+
+			if fsrc, ok := src.(*FileSource); ok {
+				lag += fsrc.Lag()
+			}
+
+			name := ""
+			if len(s.Sources) > 1 {
+				name = src.Name()
+			}
+			counts[src.Name()] += len(lines)
+
+			// Pass entries to the session storage.
+			err = s.ConsumeSourceLines(name, lines)
+			if err != nil {
+				msgChan <- msgErr(err)
+			}
+		}
+
+		if s.Metrics != nil {
+			s.Metrics.SetReadLag(lag)
+		}
+	}
+
+	var reported time.Time // end of the last report interval
+
+	// report flushes the report buffer, sends a report and returns a report sample.
+	report := func(t time.Time, final bool) *Sample {
+		// Get data accumulated during report interval and clean report buffer.
+		rep := s.FlushReport(cfg, &t)
+		rep.Final = final
+		rep.Interval = t.Sub(reported)
+		reported = t
+
+		if cfg.SendReports {
+			msgChan <- msgReport(rep)
+		}
+
+		return &Sample{
+			AvgTraffic: f.AvgTraffic,
+			Kind:       sampleKindReport,
+			States:     s.States(),
+			Tally:      rep.Tally,
+			Time:       t,
+		}
+	}
+
+	// saveState persists the read offset and the frame snapshot.
+	saveState := func(t time.Time) {
+		if s.Registry != nil {
+			for _, src := range s.Sources {
+				if fsrc, ok := src.(*FileSource); ok {
+					if stat, err := fsrc.Stat(); err == nil {
+						s.Registry.Set(fsrc.Name(), stat, fsrc.Offset(), t)
+					}
+				}
+			}
+
+			if err := s.Registry.Save(); err != nil {
+				msgChan <- msgErr(fmt.Errorf("Cannot save state: %s", err.Error()))
+			}
+		}
+
+		if cfg.SnapshotFile != "" {
+			if err := saveSnapshot(cfg.SnapshotFile, f, frames, s, cfg.PollInt, t); err != nil {
+				msgChan <- msgErr(fmt.Errorf("Cannot save snapshot: %s", err.Error()))
+			}
+		}
+	}
+
+	if cfg.SnapshotFile != "" {
+		sn, err := loadSnapshot(cfg.SnapshotFile)
+		if err != nil {
+			msgChan <- msgErr(err)
+		} else if sn != nil {
+			msgChan <- msgInfo(sn.restore(f, frames, s, cfg, time.Now()))
+		}
+	}
+
+	// Backlog is counted in reports but not in the traffic frame, rate and visitor windows and poll alerts.
+	if s.Registry != nil {
+		read()
+		s.FlushPoll()
+		counts = make(map[string]int)
+	}
+
+	// Tickers start after the replay, so the first poll covers a full interval of live traffic.
+	tickerPolling := time.NewTicker(cfg.PollInt)
+	tickerReporting := time.NewTicker(cfg.ReportInt)
+	reported = time.Now()
+
+	persist := s.Registry != nil || cfg.SnapshotFile != ""
+
+	var tickerState <-chan time.Time
+	if persist {
+		t := time.NewTicker(cfg.StateInterval)
+		defer t.Stop()
+		tickerState = t.C
+	}
+
 monitorLoop:
 	for {
 		select {
 
 		// Main completion handler.
-		case <-doneChan:
-			tickerPolling.Stop()
-			tickerReporting.Stop()
+		case <-stopChan:
+			// Entries added since the last poll go to the final report.
+			read()
 			break monitorLoop
 
+		// Configuration reload, applied between polls so frame and alert states stay intact.
+		case req := <-s.Reload:
+			{
+				if req.err != nil {
+					msgChan <- msgErr(fmt.Errorf("Configuration is not reloaded. %s", req.err.Error()))
+					close(req.done)
+					continue
+				}
+
+				if req.cfg.ReportInt != cfg.ReportInt {
+					tickerReporting.Stop()
+					tickerReporting = time.NewTicker(req.cfg.ReportInt)
+				}
+
+				cfg = req.cfg
+				s.Configure(cfg)
+
+				if req.sinks != nil {
+					s.ReplaceSinks(req.oldSinks, req.sinks)
+				}
+
+				msgChan <- msgReload(cfg, req.result)
+				close(req.done)
+			}
+
 		// Poll ticker.
 		case t := <-tickerPolling.C:
 			{
 				polls++
 
-				// Capture point data.
-				p := NewPoint(s.File, r, prevSize)
-				err := p.GetChange()
+				// New files matching patterns are read from the beginning.
+				added, err := s.Discover()
 				if err != nil {
 					msgChan <- msgErr(err)
 				}
+				for _, src := range added {
+					frames[src.Name()] = NewFrame(cfg.MTF, cfg.PollInt)
+					if err := src.SetOffset(0, false); err != nil {
+						msgChan <- msgErr(err)
+					}
+					msgChan <- msgInfo(fmt.Sprintf("New log file picked up: %s", src.Name()))
+
+					if watcher != nil {
+						if err := watcher.Add(src.Name()); err != nil {
+							msgChan <- msgErr(err)
+						}
+					}
+				}
 
 				// Register current level of traffic, i.e.
 				// quantity of log entries since last poll.
-				f.Rec(p.linesQty)
+				read()
 
-				// Pass entries to the session storage.
-				err = s.ConsumeLines(p.lines)
-				if err != nil {
-					msgChan <- msgErr(err)
+				total := 0
+				for _, n := range counts {
+					total += n
+				}
+				f.Rec(t, total)
+
+				for name, sf := range frames {
+					sf.Rec(t, counts[name])
+				}
+				counts = make(map[string]int)
+
+				if s.Metrics != nil {
+					s.Metrics.SetAvgTraffic(f.AvgTraffic)
+					s.Metrics.SetRates(f.Rates())
 				}
 
 				// Print out current point data.
 				if cfg.SendTicks {
-					msgChan <- msgPoint(f.AvgTraffic, s.AlertThreshold)
+					// Points are drawn by the TUI and the web dashboard only.
+					var points []int
+					if cfg.UI == uiTUI || cfg.HTTPAddr != "" {
+						points = f.Points()
+					}
+					msgChan <- msgPoint(f.AvgTraffic, s.AlertThreshold, points, f.Rates())
+				}
+
+				poll := s.FlushPoll()
+				for _, w := range visitors {
+					w.Add(t, poll.Visitors)
+				}
+				for _, w := range latency {
+					w.Add(t, poll.Latency)
 				}
 
 				// Monitor alert threshold.
@@ -77,22 +331,133 @@ monitorLoop:
 					if s.ShouldDeescalate(f.AvgTraffic) {
 						msgChan <- msgAlertDeesc(f.AvgTraffic, t)
 					}
+
+					// Traffic of every source when there are several ones.
+					for _, src := range s.Sources {
+						sf := frames[src.Name()]
+						if sf == nil || len(s.Sources) < 2 {
+							continue
+						}
+
+						r := &Rule{Name: sourceRule(src.Name()), Metric: metricAvgTraffic, Threshold: s.AlertThreshold}
+						esc, deesc := s.CheckSource(src.Name(), sf.AvgTraffic)
+						if esc {
+							msgChan <- msgRuleAlertEsc(r, sf.AvgTraffic, t)
+						}
+						if deesc {
+							msgChan <- msgRuleAlertDeesc(r, sf.AvgTraffic, t)
+						}
+					}
+
+					values := ruleValues(s.Rules, f, poll, visitors, latency)
+					esc, deesc := s.CheckRules(values)
+					for _, r := range esc {
+						msgChan <- msgRuleAlertEsc(r, values[r.Metric], t)
+					}
+					for _, r := range deesc {
+						msgChan <- msgRuleAlertDeesc(r, values[r.Metric], t)
+					}
+				}
+
+				s.TrackAlerts(t)
+				states := s.States()
+
+				if s.Metrics != nil {
+					for rule, st := range states {
+						s.Metrics.SetAlertState(rule, st)
+					}
 				}
 
+				// Push poll aggregates to external sinks.
+				sendSample(s, &Sample{
+					AvgTraffic: f.AvgTraffic,
+					Kind:       sampleKindPoll,
+					States:     states,
+					Tally:      poll,
+					Time:       t,
+				}, msgChan)
+
 				if polls == cfg.MaxPolls {
-					doneChan <- struct{}{}
+					break monitorLoop
 				}
 			}
 
+		// Log files written, read them without waiting for the next poll.
+		case <-events:
+			read()
+
+		// State ticker.
+		case t := <-tickerState:
+			saveState(t)
+
 		// Reporting ticker.
 		case t := <-tickerReporting.C:
-			{
-				if cfg.SendReports {
-					// Get data accumulated during report interval and clean report buffer.
-					msgChan <- msgReport(s.FlushReport(cfg, &t))
+			if cfg.SendReports || len(s.Sinks) > 0 {
+				sendSample(s, report(t, false), msgChan)
+			}
+		}
+
+	}
+
+	tickerPolling.Stop()
+	tickerReporting.Stop()
+
+	if persist {
+		saveState(time.Now())
+	}
+
+	// Shutdown: final partial report, open alerts summary and sinks flush.
+	smp := report(time.Now(), true)
+
+	msgChan <- msgOpenAlerts(s.AlertSince)
+
+	return flushSinks(s, smp, shutdownTimeout, msgChan)
+}
+
+// flushSinks sends the last sample to session sinks and closes them waiting no longer than timeout.
+// Errors are reported as messages.
+func flushSinks(s *Session, smp *Sample, timeout time.Duration, msgChan chan<- msg) error {
+	errs := make(chan error, len(s.Sinks))
+
+	for _, sink := range s.Sinks {
+		go func(sink Sink) {
+			err := sink.Send(smp)
+			if c, ok := sink.(io.Closer); ok {
+				if cerr := c.Close(); err == nil {
+					err = cerr
 				}
 			}
+			errs <- err
+		}(sink)
+	}
+
+	deadline := time.After(timeout)
+	failed := 0
+
+	for range s.Sinks {
+		select {
+		case err := <-errs:
+			if err != nil {
+				msgChan <- msgErr(err)
+				failed++
+			}
+		case <-deadline:
+			return fmt.Errorf("Sinks were not flushed within %s.", timeout)
 		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d sink(s) failed to flush.", failed)
+	}
+
+	return nil
+}
 
+// sendSample passes a sample to all session sinks, errors are reported as messages.
+func sendSample(s *Session, smp *Sample, msgChan chan<- msg) {
+	for _, sink := range s.Sinks {
+		if err := sink.Send(smp); err != nil {
+			msgChan <- msgErr(err)
+		}
 	}
 }
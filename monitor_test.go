@@ -12,8 +12,8 @@ import (
 // Test logic for alert escalation case:
 //
 // 1. Initial state is OK (default).
-// 2. Run for the MTF duration. In this test: 2 seconds.
-// 3. Imitate incoming traffic adding several lines to the temporary log file once per second.
+// 2. Run for the MTF duration plus the first poll. In this test: 3 seconds.
+// 3. Imitate incoming traffic adding several lines to the temporary log file after every poll.
 // 4. To trigger an alert, we set alert threshold level to 2 hits/s and add 2 entries per second.
 //
 // 5. Expected result:
@@ -24,20 +24,20 @@ import (
 func TestMonitor_AlertEscalation(t *testing.T) {
 	var err error
 	tempLogFile := getTempLoc(".TestMonitor_AlertEscalation.log")
-	alertThreshold := 2
-	pollInt := 1
+	alertThreshold := 2.0
+	pollInt := time.Second
 
 	cfg := &Config{
 		AlertThreshold: alertThreshold,
-		File:           tempLogFile,
-		MTF:            2,
-		MaxPolls:       2, // As poll interval 1 sec, thus we limit test to 3 sec length.
+		Files:          []string{tempLogFile},
+		MTF:            2 * time.Second,
+		MaxPolls:       3, // The first poll only marks the start, the next 2 fill the frame.
 		TopN:           3,
-		PollInt:        pollInt, // Poll once per second.
-		ReportInt:      2,       // Irrelevant, as reports are off for this test.
+		PollInt:        pollInt,         // Poll once per second.
+		ReportInt:      2 * time.Second, // Irrelevant, as reports are off for this test.
 		SendAlerts:     true,
 		SendReports:    false,
-		SendTicks:      false,
+		SendTicks:      true, // Ticks mark polls, so log lines are written in between.
 	}
 
 	s := NewSession(alertThreshold, pollInt, gonx.NewParser(parserFormat))
@@ -49,25 +49,20 @@ func TestMonitor_AlertEscalation(t *testing.T) {
 	}
 	defer f.Close()
 
-	err = s.SetLog(cfg.File)
+	err = s.SetLog(cfg.Files[0])
 	if err != nil {
 		// Suppress error as a test log file can be absent
 	}
 	// Also, not deferring a Close method, as the file will be created later.
 
-	doneChan := make(chan struct{})
+	stopChan := make(chan struct{})
 	msgChan := make(chan msg)
 
-	go Monitor(cfg, s, doneChan, msgChan)
-
-	// Handler for monitor closing.
-	go Ctrl(doneChan)
+	go Monitor(cfg, s, stopChan, msgChan)
 
 	expected := 1
 	actual := 0
 
-	logUpdateTicker := time.NewTicker(time.Second * 1)
-
 	// str mimics one-time entry of 2 log lines
 	// In this case, with 1 poll per second, this equals to a traffic of 2 hits/s, while threshold is 2 hits/s.
 	// To trigger an alert, number of lines should be equal or higher than the "AlertThreshold" value.
@@ -76,25 +71,18 @@ func TestMonitor_AlertEscalation(t *testing.T) {
 	198.155.12.16 - - [28/Jul/1995:13:17:09 -0400] "GET /images/NASA-logosmall.gif HTTP/1.0" 400 786
 	`
 
-	// Intercept message channel.
+	// Intercept message channel until the monitor stops.
 	// Instead of a printer we receive messages here to assert results based on message type.
-selectLoop:
-	for {
-		select {
-		case <-logUpdateTicker.C:
-			{
-				if _, err = f.WriteString(str); err != nil {
-					t.Fatalf("\n\nCannot writing to test log: %s\n\n", err.Error())
-				}
+	for msg := range msgChan {
+		switch msg.msgType {
+		case msgTypePoint:
+			// Lines for the next poll.
+			if _, err = f.WriteString(str); err != nil {
+				t.Fatalf("\n\nCannot writing to test log: %s\n\n", err.Error())
 			}
 
-		case msg := <-msgChan:
-			if msg.msgType == msgTypeAlertEsc {
-				actual++
-			}
-
-		case <-doneChan:
-			break selectLoop
+		case msgTypeAlertEsc:
+			actual++
 		}
 	}
 
@@ -127,17 +115,17 @@ selectLoop:
 func TestMonitor_AlertDeescalation(t *testing.T) {
 	var err error
 	tempLogFile := getTempLoc(".TestMonitor_AlertDeescalation.log")
-	alertThreshold := 2
-	pollInt := 1
+	alertThreshold := 2.0
+	pollInt := time.Second
 
 	cfg := &Config{
 		AlertThreshold: alertThreshold,
-		File:           tempLogFile,
-		MTF:            2,
+		Files:          []string{tempLogFile},
+		MTF:            2 * time.Second,
 		MaxPolls:       2, // As poll interval 1 sec, thus we limit test to 3 sec length.
 		TopN:           3,
-		PollInt:        pollInt, // Poll once per second.
-		ReportInt:      2,       // Irrelevant, as reports are off for this test.
+		PollInt:        pollInt,         // Poll once per second.
+		ReportInt:      2 * time.Second, // Irrelevant, as reports are off for this test.
 		SendAlerts:     true,
 		SendReports:    false,
 		SendTicks:      false,
@@ -153,35 +141,24 @@ func TestMonitor_AlertDeescalation(t *testing.T) {
 	}
 	defer f.Close()
 
-	err = s.SetLog(cfg.File)
+	err = s.SetLog(cfg.Files[0])
 	if err != nil {
 		// Suppress error as a test log file can be absent
 	}
 	// Also, not deferring a Close method, as the file will be created later.
 
-	doneChan := make(chan struct{})
+	stopChan := make(chan struct{})
 	msgChan := make(chan msg)
 
-	go Monitor(cfg, s, doneChan, msgChan)
-
-	// Handler for monitor closing.
-	go Ctrl(doneChan)
+	go Monitor(cfg, s, stopChan, msgChan)
 
 	expected := 1
 	actual := 0
 
-	// Intercept message channel.
-selectLoop:
-	for {
-		select {
-
-		case msg := <-msgChan:
-			if msg.msgType == msgTypeAlertDeesc {
-				actual++
-			}
-
-		case <-doneChan:
-			break selectLoop
+	// Intercept message channel until the monitor stops.
+	for msg := range msgChan {
+		if msg.msgType == msgTypeAlertDeesc {
+			actual++
 		}
 	}
 
@@ -200,6 +177,169 @@ selectLoop:
 	}
 }
 
+// Test logic for a graceful stop:
+//
+// 1. Add log lines right after the first poll and stop the monitor before the next one.
+//
+// 2. Expected result:
+// - lines added since the last poll are read,
+// - a final report with these lines is sent,
+// - open alerts are listed,
+// - message channel is closed.
+func TestMonitor_Stop(t *testing.T) {
+	tempLogFile := getTempLoc(".TestMonitor_Stop.log")
+
+	cfg := &Config{
+		AlertThreshold: 100,
+		Files:          []string{tempLogFile},
+		MTF:            2 * time.Second,
+		MaxPolls:       10,
+		TopN:           3,
+		PollInt:        time.Second,
+		ReportInt:      10 * time.Second,
+		SendAlerts:     false, // Keeps the alert open.
+		SendReports:    true,
+		SendTicks:      true,
+	}
+
+	s := NewSession(cfg.AlertThreshold, cfg.PollInt, gonx.NewParser(parserFormat))
+	s.SetAlert()
+	s.AlertSince = map[string]time.Time{ruleTraffic: time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)}
+
+	f, err := os.Create(tempLogFile)
+	if err != nil {
+		t.Fatalf("\n\nCannot open test file: %s\n", err.Error())
+	}
+	defer f.Close()
+	defer os.Remove(tempLogFile)
+
+	if err := s.SetLog(cfg.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	stopChan := make(chan struct{})
+	msgChan := make(chan msg)
+
+	done := make(chan error)
+	go func() {
+		done <- Monitor(cfg, s, stopChan, msgChan)
+	}()
+
+	var final *Report
+	var summary string
+
+	for m := range msgChan {
+		switch m.msgType {
+		case msgTypePoint:
+			f.WriteString("198.155.12.16 - - [28/Jul/1995:13:17:09 -0400] \"GET /images/NASA-logosmall.gif HTTP/1.0\" 200 786\n")
+			close(stopChan)
+		case msgTypeReport:
+			final = m.report
+		case msgTypeOpenAlerts:
+			summary = m.body
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Monitor should stop without errors, got %s", err.Error())
+	}
+
+	if final == nil || !final.Final || final.TotalHits != 1 {
+		t.Errorf("Expected a final report with %d hit, got %+v", 1, final)
+	}
+	if final != nil && (final.Interval <= 0 || final.Interval >= cfg.ReportInt) {
+		t.Errorf("Expected a partial interval, got %s", final.Interval)
+	}
+
+	expected := "Alerts still open: traffic since 2017-02-06T01:48:10Z."
+	if summary != expected {
+		t.Errorf("Expected summary %q, got %q", expected, summary)
+	}
+}
+
+// A restart with --state-file replays the backlog into the next report,
+// while the traffic average and rate windows see live traffic only, so the backlog raises no alert.
+func TestMonitor_RestartReplay(t *testing.T) {
+	tempLogFile := getTempLoc(".TestMonitor_RestartReplay.log")
+	stateFile := getTempLoc(".TestMonitor_RestartReplay.json")
+	defer os.Remove(tempLogFile)
+	defer os.Remove(stateFile)
+
+	cfg := &Config{
+		AlertThreshold: 2,
+		Files:          []string{tempLogFile},
+		MTF:            time.Second,
+		MaxPolls:       2,
+		TopN:           3,
+		PollInt:        500 * time.Millisecond,
+		ReportInt:      time.Minute,
+		SendAlerts:     true,
+		SendReports:    true,
+		SendTicks:      true,
+		StateInterval:  time.Minute,
+		Windows:        []time.Duration{time.Second},
+	}
+
+	f, err := os.Create(tempLogFile)
+	if err != nil {
+		t.Fatalf("\n\nCannot open test file: %s\n", err.Error())
+	}
+	defer f.Close()
+
+	s := NewSession(cfg.AlertThreshold, cfg.PollInt, gonx.NewParser(parserFormat))
+	if err := s.SetLog(cfg.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous run stopped at the beginning of the file, then the backlog was logged.
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := fileID(stat); !ok {
+		t.Skip("Read offsets are not resumed on this platform.")
+	}
+
+	s.Registry, err = NewRegistry(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Registry.Set(tempLogFile, stat, 0, time.Now())
+
+	backlog := 100
+	for i := 0; i < backlog; i++ {
+		f.WriteString("198.155.12.16 - - [28/Jul/1995:13:17:09 -0400] \"GET /images/NASA-logosmall.gif HTTP/1.0\" 200 786\n")
+	}
+
+	stopChan := make(chan struct{})
+	msgChan := make(chan msg)
+	go Monitor(cfg, s, stopChan, msgChan)
+
+	alerts := 0
+	var final *Report
+
+	for m := range msgChan {
+		switch m.msgType {
+		case msgTypePoint:
+			if m.traffic != 0 || m.rates[0].Rate != 0 {
+				t.Errorf("Expected no live traffic, got average %v, rates %+v", m.traffic, m.rates)
+			}
+		case msgTypeAlertEsc:
+			alerts++
+		case msgTypeReport:
+			final = m.report
+		}
+	}
+
+	if alerts != 0 {
+		t.Errorf("Expected no alerts, got %d", alerts)
+	}
+
+	if final == nil || final.TotalHits != backlog {
+		t.Errorf("Expected the backlog of %d hits in the final report, got %+v", backlog, final)
+	}
+}
+
 // getTempLoc prepares full temporary file location.
 // One of the purposes - workaround between differences of MacOS temp folder ending with a slash,
 // and Debian TMPDIR env var being empty and thus os.TempDir() was creating a temp dir
@@ -207,3 +347,28 @@ selectLoop:
 func getTempLoc(filename string) string {
 	return strings.TrimRight(os.TempDir(), "/") + "/" + filename
 }
+
+// blockingSink never returns from Send.
+type blockingSink struct{}
+
+func (blockingSink) Send(smp *Sample) error {
+	select {}
+}
+
+func TestFlushSinks(t *testing.T) {
+	smp := &Sample{Kind: sampleKindReport, Tally: NewTally()}
+	msgChan := make(chan msg, 1)
+
+	ok := &testSink{}
+	s := NewSession(2, time.Second, nil)
+	s.Sinks = []Sink{ok}
+
+	if err := flushSinks(s, smp, time.Second, msgChan); err != nil || ok.sent != 1 {
+		t.Errorf("Expected the sample sent without errors, got %d sent, %v", ok.sent, err)
+	}
+
+	s.Sinks = []Sink{ok, blockingSink{}}
+	if err := flushSinks(s, smp, 10*time.Millisecond, msgChan); err == nil {
+		t.Error("Expected a deadline error")
+	}
+}
@@ -1,14 +1,23 @@
 package main
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 type msg struct {
 	msgType   string
 	body      string
+	config    *Config // configuration in effect after a reload
+	metric    string  // metric of a rule alert
+	points    []int   // hits per poll during MTF, oldest first
+	rates     []WindowRate
 	report    *Report
+	rule      string // rule of an alert, empty for the built-in traffic rule
 	time      time.Time
-	traffic   int
-	threshold int
+	traffic   float64 // average traffic or a value of a rule metric
+	threshold float64
 }
 
 const (
@@ -17,13 +26,16 @@ const (
 	msgTypeAlertEsc   = "alertEsc"
 	msgTypeAlertDeesc = "alertDeesc"
 	msgTypeError      = "err"
+	msgTypeInfo       = "info"
+	msgTypeOpenAlerts = "openAlerts"
 	msgTypePoint      = "point"
+	msgTypeReload     = "reload"
 	msgTypeReport     = "report"
 )
 
 // Message objects.
 
-func msgAlertEsc(tr int, t time.Time) msg {
+func msgAlertEsc(tr float64, t time.Time) msg {
 	return msg{
 		msgType: msgTypeAlertEsc,
 		traffic: tr,
@@ -31,7 +43,7 @@ func msgAlertEsc(tr int, t time.Time) msg {
 	}
 }
 
-func msgAlertDeesc(tr int, t time.Time) msg {
+func msgAlertDeesc(tr float64, t time.Time) msg {
 	return msg{
 		msgType: msgTypeAlertDeesc,
 		traffic: tr,
@@ -39,6 +51,77 @@ func msgAlertDeesc(tr int, t time.Time) msg {
 	}
 }
 
+func msgRuleAlertEsc(r *Rule, v float64, t time.Time) msg {
+	return msg{
+		msgType:   msgTypeAlertEsc,
+		metric:    r.Metric,
+		rule:      r.Name,
+		threshold: r.Threshold,
+		traffic:   v,
+		time:      t,
+	}
+}
+
+func msgRuleAlertDeesc(r *Rule, v float64, t time.Time) msg {
+	return msg{
+		msgType:   msgTypeAlertDeesc,
+		metric:    r.Metric,
+		rule:      r.Name,
+		threshold: r.Threshold,
+		traffic:   v,
+		time:      t,
+	}
+}
+
+func msgReload(cfg *Config, res *reloadResult) msg {
+	body := "Configuration reloaded, no changes applied."
+	if len(res.Applied) > 0 {
+		body = "Configuration reloaded. Applied: " + strings.Join(res.Applied, "; ") + "."
+	}
+	if len(res.Restart) > 0 {
+		body += " Requires restart, ignored: " + strings.Join(res.Restart, "; ") + "."
+	}
+
+	return msg{
+		msgType: msgTypeReload,
+		body:    body,
+		config:  cfg,
+		time:    time.Now(),
+	}
+}
+
+// msgOpenAlerts lists alerts still open on shutdown.
+func msgOpenAlerts(since map[string]time.Time) msg {
+	body := "No open alerts."
+
+	if len(since) > 0 {
+		rules := make([]string, 0, len(since))
+		for rule := range since {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+
+		for i, rule := range rules {
+			rules[i] = rule + " since " + since[rule].Format(reportTimeFormat)
+		}
+		body = "Alerts still open: " + strings.Join(rules, ", ") + "."
+	}
+
+	return msg{
+		msgType: msgTypeOpenAlerts,
+		body:    body,
+		time:    time.Now(),
+	}
+}
+
+func msgInfo(s string) msg {
+	return msg{
+		msgType: msgTypeInfo,
+		body:    s,
+		time:    time.Now(),
+	}
+}
+
 func msgErr(err error) msg {
 	return msg{
 		msgType: msgTypeError,
@@ -46,9 +129,11 @@ func msgErr(err error) msg {
 	}
 }
 
-func msgPoint(tr, th int) msg {
+func msgPoint(tr, th float64, points []int, rates []WindowRate) msg {
 	return msg{
 		msgType:   msgTypePoint,
+		points:    points, // a copy of the frame, it keeps changing after the message is sent
+		rates:     rates,
 		threshold: th,
 		traffic:   tr,
 	}
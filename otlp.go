@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defOTLPServiceName = "http-traffic-monitor"
+	otlpScopeName      = "github.com/mpmlj/http-traffic-monitor"
+	otlpTimeout        = 5 * time.Second
+
+	// AggregationTemporality enum of the OTLP metrics data model.
+	otlpCumulative = 2
+)
+
+// OTLPSink exports poll samples to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+// Hits, status classes and bytes are cumulative monotonic sums since sink start,
+// so samples are expected to hold totals, see CumulativeSink.
+// Average traffic and alert states are gauges.
+type OTLPSink struct {
+	client   *http.Client
+	endpoint string
+	resource []otlpKeyValue
+	start    time.Time
+}
+
+// NewOTLPSink returns an OTLP sink posting to endpoint, ex. http://localhost:4318/v1/metrics.
+// attrs are added to the resource as string attributes.
+func NewOTLPSink(endpoint string, attrs map[string]string) *OTLPSink {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, otlpString(k, attrs[k]))
+	}
+
+	return &OTLPSink{
+		client:   &http.Client{Timeout: otlpTimeout},
+		endpoint: endpoint,
+		resource: res,
+		start:    time.Now(),
+	}
+}
+
+// Send exports totals and gauges of a poll sample.
+// Report samples are skipped as their hits are already counted by polls.
+func (s *OTLPSink) Send(smp *Sample) error {
+	if smp.Kind != sampleKindPoll {
+		return nil
+	}
+
+	b, err := json.Marshal(s.request(smp))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP export failed: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// request builds an export request with totals and gauges of smp.
+func (s *OTLPSink) request(smp *Sample) *otlpRequest {
+	start := otlpTime(s.start)
+	now := otlpTime(smp.Time)
+
+	sum := func(name, unit, desc string, points []otlpDataPoint) otlpMetric {
+		for i := range points {
+			points[i].StartTimeUnixNano = start
+			points[i].TimeUnixNano = now
+		}
+		return otlpMetric{
+			Name:        name,
+			Unit:        unit,
+			Description: desc,
+			Sum: &otlpSum{
+				AggregationTemporality: otlpCumulative,
+				IsMonotonic:            true,
+				DataPoints:             points,
+			},
+		}
+	}
+
+	var codes []otlpDataPoint
+	for _, g := range []uint8{2, 3, 4, 5} {
+		codes = append(codes, otlpDataPoint{
+			AsInt:      otlpInt(int64(smp.Tally.StatusCodes[g])),
+			Attributes: []otlpKeyValue{otlpString("status_class", fmt.Sprintf("%dxx", g))},
+		})
+	}
+
+	var states []otlpDataPoint
+	for _, k := range sortedKeys(smp.States) {
+		states = append(states, otlpDataPoint{
+			AsInt:        otlpInt(int64(smp.States[k])),
+			TimeUnixNano: now,
+			Attributes:   []otlpKeyValue{otlpString("rule", k)},
+		})
+	}
+
+	metrics := []otlpMetric{
+		sum("traffic_monitor.hits", "{request}", "Parsed log entries.",
+			[]otlpDataPoint{{AsInt: otlpInt(int64(smp.Tally.Hits))}}),
+		sum("traffic_monitor.status_hits", "{request}", "Parsed log entries by status class.", codes),
+		sum("traffic_monitor.bytes_sent", "By", "Total size of responses.",
+			[]otlpDataPoint{{AsInt: otlpInt(smp.Tally.Bytes)}}),
+		{
+			Name:        "traffic_monitor.avg_traffic",
+			Unit:        "{request}",
+			Description: "Average hits per second during the monitoring time frame.",
+			Gauge: &otlpGauge{DataPoints: []otlpDataPoint{
+				{AsDouble: &smp.AvgTraffic, TimeUnixNano: now},
+			}},
+		},
+		{
+			Name:        "traffic_monitor.alert_state",
+			Unit:        "1",
+			Description: "Alert state per rule: 0 - OK, 2 - alert.",
+			Gauge:       &otlpGauge{DataPoints: states},
+		},
+	}
+
+	return &otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: s.resource},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: otlpScopeName},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+// OTLP JSON structures, see opentelemetry-proto/opentelemetry/proto/metrics/v1.
+// 64-bit integers are encoded as strings as required by the protobuf JSON mapping.
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsInt             string         `json:"asInt,omitempty"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpString(k, v string) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: v}}
+}
+
+func otlpInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// parseAttrs parses a comma-separated list of key=value pairs.
+func parseAttrs(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return out, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Invalid attribute %q, expected key=value", kv)
+		}
+		out[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return out, nil
+}
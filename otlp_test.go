@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOTLPSink_Send(t *testing.T) {
+	var actual otlpRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected JSON content type, got %s", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&actual); err != nil {
+			t.Errorf("Cannot decode request: %s", err.Error())
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewCumulativeSink(NewOTLPSink(srv.URL+"/v1/metrics", map[string]string{
+		"service.name": "web",
+		"host.name":    "box1",
+	}))
+
+	// Two polls, sums are cumulative.
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(testSample(sampleKindPoll)); err != nil {
+			t.Fatalf("Send should not fail. Error: %+v", err)
+		}
+	}
+
+	// Report samples are not exported.
+	if err := sink.Send(testSample(sampleKindReport)); err != nil {
+		t.Fatalf("Send should not fail. Error: %+v", err)
+	}
+
+	rm := actual.ResourceMetrics[0]
+
+	expectedRes := []otlpKeyValue{otlpString("host.name", "box1"), otlpString("service.name", "web")}
+	if !reflect.DeepEqual(expectedRes, rm.Resource.Attributes) {
+		t.Errorf("Expected resource %+v, got %+v", expectedRes, rm.Resource.Attributes)
+	}
+
+	metrics := make(map[string]otlpMetric)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	hits := metrics["traffic_monitor.hits"]
+	if hits.Sum == nil || hits.Sum.DataPoints[0].AsInt != "6" || !hits.Sum.IsMonotonic ||
+		hits.Sum.AggregationTemporality != otlpCumulative {
+		t.Errorf("Unexpected hits metric: %+v", hits.Sum)
+	}
+
+	codes := metrics["traffic_monitor.status_hits"]
+	if codes.Sum == nil || len(codes.Sum.DataPoints) != 4 || codes.Sum.DataPoints[3].AsInt != "2" {
+		t.Errorf("Unexpected status hits metric: %+v", codes.Sum)
+	}
+
+	bytes := metrics["traffic_monitor.bytes_sent"]
+	if bytes.Sum == nil || bytes.Sum.DataPoints[0].AsInt != "3000" {
+		t.Errorf("Unexpected bytes metric: %+v", bytes.Sum)
+	}
+
+	avg := metrics["traffic_monitor.avg_traffic"]
+	if avg.Gauge == nil || avg.Gauge.DataPoints[0].AsDouble == nil || *avg.Gauge.DataPoints[0].AsDouble != 4 {
+		t.Errorf("Unexpected avg traffic metric: %+v", avg.Gauge)
+	}
+
+	state := metrics["traffic_monitor.alert_state"]
+	if state.Gauge == nil || state.Gauge.DataPoints[0].Attributes[0].Value.StringValue != ruleTraffic {
+		t.Errorf("Unexpected alert state metric: %+v", state.Gauge)
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	expected := map[string]string{"env": "prod", "dc": "east"}
+
+	actual, err := parseAttrs("env=prod, dc=east")
+	if err != nil {
+		t.Fatalf("parseAttrs should not fail. Error: %+v", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v, got %+v", expected, actual)
+	}
+
+	if _, err := parseAttrs("env"); err == nil {
+		t.Error("parseAttrs should fail on a missing value.")
+	}
+}
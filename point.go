@@ -13,6 +13,8 @@ type Point struct {
 	prevSize int64
 	size     int64
 	diff     int64
+	lag      int64 // bytes left unread after the last read
+	offset   int64 // position of the next unread byte
 	lines    []string
 	linesQty int
 	reader   *bufio.Reader
@@ -41,22 +43,41 @@ func (p *Point) GetChange() error {
 
 	// If truncated, adjust for a new size and continue from beginning.
 	if p.diff > 0 {
-		p.lines, err = readIncrement(p.reader)
+		var tail []byte
+		p.lines, tail, err = readIncrement(p.reader)
 		if err != nil {
 			return fmt.Errorf(" Error reading log chunk: %s ", err.Error())
 		}
 
 		p.linesQty = len(p.lines)
+
+		// A line being written is read again once it is terminated.
+		if len(tail) > 0 {
+			if _, err := p.file.Seek(-int64(len(tail)), io.SeekCurrent); err != nil {
+				return err
+			}
+			p.reader.Reset(p.file)
+		}
 	}
 
 	p.prevSize = p.size
 
+	pos, err := p.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	// Data already buffered by the reader has not been consumed yet.
+	p.offset = pos - int64(p.reader.Buffered())
+	p.lag = p.size - p.offset
+
 	return nil
 }
 
 // readIncrement reads a log file from a start position to EOF
-// returning result as a slice of (string) log entries.
-func readIncrement(r *bufio.Reader) ([]string, error) {
+// returning result as a slice of (string) log entries
+// and the unterminated tail of a line still being written.
+func readIncrement(r *bufio.Reader) ([]string, []byte, error) {
 
 	var data []byte
 	var err error
@@ -65,7 +86,7 @@ func readIncrement(r *bufio.Reader) ([]string, error) {
 	for {
 		data, err = r.ReadBytes('\n')
 
-		if err == nil || err == io.EOF {
+		if err == nil {
 			line := strings.TrimSpace(string(data))
 			if line != "" {
 				out = append(out, line)
@@ -74,7 +95,7 @@ func readIncrement(r *bufio.Reader) ([]string, error) {
 
 		if err != nil {
 			if err != io.EOF {
-				return out, err
+				return out, nil, err
 			}
 
 			// EOF
@@ -82,5 +103,5 @@ func readIncrement(r *bufio.Reader) ([]string, error) {
 		}
 	}
 
-	return out, nil
+	return out, data, nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,42 +15,74 @@ var (
 	reportTimeFormat = time.RFC3339
 )
 
-// Printer is a handler for stdout outputs.
-func Printer(cfg *Config, doneChan <-chan struct{}, msgChan <-chan msg) {
-
-printerLoop:
-	for {
-		select {
-		case <-doneChan:
-			break printerLoop
-
-		case m := <-msgChan:
-			switch m.msgType {
-			case msgTypeError:
-				printErr(m.body)
-			case msgTypeAlertEsc:
-				printAlertEsc(m.traffic, m.time)
-			case msgTypeAlertDeesc:
-				printAlertDeesc(m.traffic, m.time)
-			case msgTypePoint:
-				printPoint(m.traffic, m.threshold)
-			case msgTypeReport:
-				printReport(cfg, m.report)
-			}
+// Printer is a handler for stdout outputs, it returns when msgChan is closed.
+func Printer(cfg *Config, msgChan <-chan msg) {
+	for m := range msgChan {
+		switch m.msgType {
+		case msgTypeError:
+			printErr(m.body)
+		case msgTypeAlertEsc, msgTypeAlertDeesc:
+			printAlert(m)
+		case msgTypePoint:
+			printPoint(m.traffic, m.threshold, m.rates)
+		case msgTypeReport:
+			printReport(cfg, m.report)
+		case msgTypeReload:
+			cfg = m.config
+			printReload(m.body)
+		case msgTypeInfo, msgTypeOpenAlerts:
+			fmt.Printf("\n%s\n", m.body)
+		}
+	}
+}
+
+// printAlert prints an alert message of the built-in traffic rule or a configured one.
+func printAlert(m msg) {
+	esc := m.msgType == msgTypeAlertEsc
+
+	if m.rule == "" {
+		if esc {
+			printAlertEsc(m.traffic, m.time)
+		} else {
+			printAlertDeesc(m.traffic, m.time)
 		}
+		return
 	}
 
+	// Rule name becomes a part of the format string.
+	name := strings.Replace(m.rule, "%", "%%", -1)
+	if esc {
+		printBigMsg("\u00B7 Rule "+name+" ("+m.metric+") generated an alert - value = %s, triggered at %s", m.traffic, m.time, ct.Red)
+	} else {
+		printBigMsg("\u00B7 Rule "+name+" ("+m.metric+") alert recovered. Current value = %s. At %s", m.traffic, m.time, ct.Green)
+	}
+}
+
+// alertText returns a one-line description of an alert message without its time.
+func alertText(m msg) string {
+	esc := m.msgType == msgTypeAlertEsc
+
+	switch {
+	case m.rule == "" && esc:
+		return fmt.Sprintf("High traffic generated an alert - hits = %s", formatValue(m.traffic))
+	case m.rule == "":
+		return fmt.Sprintf("High traffic alert recovered. Current hits = %s", formatValue(m.traffic))
+	case esc:
+		return fmt.Sprintf("Rule %s (%s) generated an alert - value = %s", m.rule, m.metric, formatValue(m.traffic))
+	default:
+		return fmt.Sprintf("Rule %s (%s) alert recovered. Current value = %s", m.rule, m.metric, formatValue(m.traffic))
+	}
 }
 
 // printAlertEsc prints alert escalation message.
-func printAlertEsc(tr int, t time.Time) {
-	printBigMsg("\u00B7 High traffic generated an alert - hits = %d, triggered at %s", tr, t, ct.Red)
+func printAlertEsc(tr float64, t time.Time) {
+	printBigMsg("\u00B7 High traffic generated an alert - hits = %s, triggered at %s", tr, t, ct.Red)
 
 }
 
 // printAlertDeesc prints alert de-escalation message.
-func printAlertDeesc(tr int, t time.Time) {
-	printBigMsg("\u00B7 High traffic alert recovered. Current hits = %d. At %s", tr, t, ct.Green)
+func printAlertDeesc(tr float64, t time.Time) {
+	printBigMsg("\u00B7 High traffic alert recovered. Current hits = %s. At %s", tr, t, ct.Green)
 }
 
 // printReport prints out a report block.
@@ -60,25 +93,70 @@ func printReport(cfg *Config, r *Report) {
 		fmt.Print("\n\n")
 		printHR()
 
-		fmt.Printf("REPORT: %s\n\n", r.Time.Format(reportTimeFormat))
+		if r.Final {
+			fmt.Printf("FINAL REPORT, partial interval: %s\n\n", r.Time.Format(reportTimeFormat))
+		} else {
+			fmt.Printf("REPORT: %s\n\n", r.Time.Format(reportTimeFormat))
+		}
+
+		printSections(cfg.TopN, r)
 
-		printSections(cfg.TopN, r.TopSectionHits)
+		if len(r.Sources) > 0 {
+			printSources(cfg.TopN, r.Sources)
+		}
 
 		printSummary(cfg, r)
 
+		if r.Tally != nil && r.Tally.Bytes > 0 {
+			printBandwidth(cfg, r)
+		}
+
+		if r.Latency != nil {
+			printLatency(r)
+		}
+
 		fmt.Print("\n\n")
 	}
 }
 
-// printPoint prints out a point data.
-func printPoint(traffic, threshold int) {
+// printPoint prints out a point data, rolling rates are shown like load averages.
+func printPoint(traffic, threshold float64, rates []WindowRate) {
 	fmt.Print(" \u00B7  hits avg: ")
 	if traffic >= threshold {
-		printRed("%6d", traffic)
+		printRed("%6s", formatValue(traffic))
 	} else {
-		fmt.Printf("%6d", traffic)
+		fmt.Printf("%6s", formatValue(traffic))
+	}
+	fmt.Printf("  / %2s", formatValue(threshold))
+
+	if len(rates) > 0 {
+		fmt.Printf("   %s\n", ratesText(rates))
+	} else {
+		fmt.Print("\n")
 	}
-	fmt.Printf("  / %2d\n", threshold)
+}
+
+// ratesText returns rolling rates in one line, ex. "1m/5m/15m: 4.2 3.1 2.05".
+func ratesText(rates []WindowRate) string {
+	names := make([]string, len(rates))
+	values := make([]string, len(rates))
+	for i, r := range rates {
+		names[i] = r.Window
+		values[i] = formatValue(r.Rate)
+	}
+	return strings.Join(names, "/") + ": " + strings.Join(values, " ")
+}
+
+// formatValue formats a rate or a metric value for display, rounded to 2 decimal places.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// printReload prints configuration reload details.
+func printReload(s string) {
+	fmt.Print("\n")
+	fmt.Printf("CONFIG: %s\n", s)
+	fmt.Print("\n")
 }
 
 func printErr(s string, a ...interface{}) {
@@ -120,36 +198,108 @@ func printRed(s string, a ...interface{}) {
 	ct.ResetColor()
 }
 
-// printSections prints out a top sections block of a report.
-func printSections(n uint, s map[int]Pair) {
+// printSections prints out a top sections block of a report,
+// approximate counts are followed by their maximum overestimation, ex. "1200 ±8".
+func printSections(n uint, r *Report) {
+	s := r.TopSectionHits
 	if len(s) == 0 {
 		fmt.Printf("Top %d sections: no entries\n", n)
 	} else {
 		fmt.Printf("Top %d sections\n", n)
 		fmt.Print("| sections                                                       | count")
+		if r.SectionVisitors != nil {
+			fmt.Print("      | visitors")
+		}
 		fmt.Print("\n")
 		printHR()
 		for i := 0; i < len(s); i++ {
 			fmt.Print("| " + rightPad2Len(s[i].Key, " ", 63))
-			fmt.Print("| " + rightPad2Len(strconv.Itoa(s[i].Value), " ", 10))
+			fmt.Print("| " + rightPad2Len(countText(s[i].Value, r.SectionErrors[s[i].Key]), " ", 11))
+			if r.SectionVisitors != nil {
+				fmt.Print("| " + rightPad2Len(strconv.Itoa(r.SectionVisitors[s[i].Key]), " ", 10))
+			}
 			fmt.Print("\n")
 		}
 	}
 	fmt.Print("\n")
 }
 
+// countText formats a count with its error bound, if any.
+func countText(v, err int) string {
+	if err == 0 {
+		return strconv.Itoa(v)
+	}
+	return strconv.Itoa(v) + " \u00B1" + strconv.Itoa(err)
+}
+
+// printSources prints out hits and status codes by log file or syslog host,
+// each followed by its top n sections.
+func printSources(n uint, t map[string]*Tally) {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Print("Sources\n")
+	fmt.Print("| file or host                  | count     | 2xx     | 3xx     | 4xx     | 5xx")
+	fmt.Print("\n")
+	printHR()
+	for _, name := range names {
+		st := t[name]
+		fmt.Print("| " + rightPad2Len(name, " ", 30))
+		fmt.Print("| " + rightPad2Len(strconv.Itoa(st.Hits), " ", 10))
+		for g := uint8(2); g <= 5; g++ {
+			fmt.Print("| " + rightPad2Len(strconv.Itoa(st.StatusCodes[g]), " ", 8))
+		}
+		fmt.Print("\n")
+
+		if top := sourceTopText(n, st); top != "" {
+			fmt.Print("|   top: " + top + "\n")
+		}
+	}
+	fmt.Print("\n")
+}
+
+// sourceTopText returns top n sections of a source with their counts, ex. "/api 12, /shuttle 3".
+func sourceTopText(n uint, t *Tally) string {
+	hl := CutTopN(RankByHits(t.Sections), n)
+
+	parts := make([]string, len(hl))
+	for i := 0; i < len(hl); i++ {
+		err := 0
+		if t.Top != nil {
+			err = t.Top.Err(hl[i].Key)
+		}
+		parts[i] = hl[i].Key + " " + countText(hl[i].Value, err)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
 // printSummary prints out a summary part of a report.
 func printSummary(cfg *Config, r *Report) {
 
+	// Distinct visitors are estimated, counted unless disabled.
+	visitors := r.SectionVisitors != nil
+
 	fmt.Print("Summary:\n")
-	fmt.Print("| hits total | hits/s     | 2xx        | 3xx        | 4xx        | 5xx        ")
+	fmt.Print("| hits total | hits/s     ")
+	if visitors {
+		fmt.Print("| visitors   ")
+	}
+	fmt.Print("| 2xx        | 3xx        | 4xx        | 5xx        ")
 	fmt.Print("\n")
 	printHR()
 	fmt.Print("| " + rightPad2Len(strconv.Itoa(r.TotalHits), " ", 11))
 
 	// total hits / seconds for this interval
-	hits := int(math.Ceil(float64(r.TotalHits / cfg.ReportInt)))
-	fmt.Print("| " + rightPad2Len(strconv.Itoa(hits), " ", 11))
+	hits := float64(r.TotalHits) / reportSeconds(cfg, r)
+	fmt.Print("| " + rightPad2Len(formatValue(hits), " ", 11))
+
+	if visitors {
+		fmt.Print("| " + rightPad2Len(strconv.Itoa(r.Visitors), " ", 11))
+	}
 
 	fmt.Print("| " + rightPad2Len(strconv.Itoa(r.StatusCodes[2]), " ", 11))
 	fmt.Print("| " + rightPad2Len(strconv.Itoa(r.StatusCodes[3]), " ", 11))
@@ -171,6 +321,93 @@ func printSummary(cfg *Config, r *Report) {
 	fmt.Print("\n")
 }
 
+// reportSeconds returns the length of the report interval, a final one is usually shorter than the configured one.
+func reportSeconds(cfg *Config, r *Report) float64 {
+	if r.Interval > 0 {
+		return r.Interval.Seconds()
+	}
+	return cfg.ReportInt.Seconds()
+}
+
+// printBandwidth prints out response sizes and top sections by bytes sent.
+func printBandwidth(cfg *Config, r *Report) {
+	fmt.Print("\n")
+	fmt.Print("Bandwidth:\n")
+	fmt.Print("| bytes total | bytes/s     | avg size    | max size    ")
+	fmt.Print("\n")
+	printHR()
+	fmt.Print("| " + rightPad2Len(formatBytes(float64(r.Tally.Bytes)), " ", 12))
+	fmt.Print("| " + rightPad2Len(formatBytes(float64(r.Tally.Bytes)/reportSeconds(cfg, r)), " ", 12))
+	fmt.Print("| " + rightPad2Len(formatBytes(r.Tally.AvgBytes()), " ", 12))
+	fmt.Print("| " + rightPad2Len(formatBytes(float64(r.Tally.MaxBytes)), " ", 12))
+	fmt.Print("\n\n")
+
+	fmt.Printf("Top %d sections by bytes\n", cfg.TopN)
+	fmt.Print("| sections                                                       | bytes")
+	fmt.Print("\n")
+	printHR()
+	for i := 0; i < len(r.TopSectionBytes); i++ {
+		fmt.Print("| " + rightPad2Len(r.TopSectionBytes[i].Key, " ", 63))
+		fmt.Print("| " + rightPad2Len(bytesText(r.TopSectionBytes[i].Value, r.SectionBytesErrors[r.TopSectionBytes[i].Key]), " ", 11))
+		fmt.Print("\n")
+	}
+}
+
+// bytesText formats bytes sent with their error bound, if any.
+func bytesText(v, err int) string {
+	if err == 0 {
+		return formatBytes(float64(v))
+	}
+	return formatBytes(float64(v)) + " \u00B1" + formatBytes(float64(err))
+}
+
+// printLatency prints out latency quantiles of the interval and of top sections.
+func printLatency(r *Report) {
+	fmt.Print("\n")
+	fmt.Print("Latency:\n")
+	fmt.Print("| sections                      | p50        | p90        | p95        | p99        | max")
+	fmt.Print("\n")
+	printHR()
+	printLatencyRow("all", r.Latency)
+	for i := 0; i < len(r.TopSectionHits); i++ {
+		if st := r.SectionLatency[r.TopSectionHits[i].Key]; st != nil {
+			printLatencyRow(r.TopSectionHits[i].Key, st)
+		}
+	}
+}
+
+func printLatencyRow(name string, st *LatencyStats) {
+	fmt.Print("| " + rightPad2Len(name, " ", 30))
+	for _, v := range latencyValues(st) {
+		fmt.Print("| " + rightPad2Len(formatLatency(v), " ", 11))
+	}
+	fmt.Print("\n")
+}
+
+// formatLatency formats a latency with 3-4 significant digits, ex. "1.234s", "12.35ms", "1.234ms", "350µs".
+func formatLatency(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= 10*time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// formatBytes formats a size with a binary unit, ex. "1.5 MiB".
+func formatBytes(v float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+
+	return formatValue(v) + " " + units[i]
+}
+
 func rightPad2Len(s string, padStr string, overallLen int) string {
 	var padCountInt int
 	padCountInt = 1 + ((overallLen - len(padStr)) / len(padStr))
@@ -178,7 +415,7 @@ func rightPad2Len(s string, padStr string, overallLen int) string {
 	return retStr[:overallLen]
 }
 
-func printBigMsg(s string, tr int, t time.Time, bg ct.Color) {
+func printBigMsg(s string, tr float64, t time.Time, bg ct.Color) {
 	fmt.Print("\n")
 
 	ct.ChangeColor(ct.White, true, bg, true)
@@ -187,7 +424,7 @@ func printBigMsg(s string, tr int, t time.Time, bg ct.Color) {
 
 	fmt.Print("\n")
 
-	str := fmt.Sprintf(s, tr, t.Format(time.RFC3339))
+	str := fmt.Sprintf(s, formatValue(tr), t.Format(time.RFC3339))
 	size := len(str)
 	remaining := strconv.Itoa(86 - size)
 
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[float64]string{
+		0:           "0 B",
+		1000:        "1000 B",
+		1536:        "1.5 KiB",
+		3 * 1 << 30: "3 GiB",
+	}
+
+	for v, expected := range tests {
+		if actual := formatBytes(v); actual != expected {
+			t.Errorf("formatBytes(%v): expected %q, got %q", v, expected, actual)
+		}
+	}
+}
+
+func TestSourceTopText(t *testing.T) {
+	tally := NewTally()
+	tally.Sections = map[string]int{"/api": 12, "/shuttle": 3, "/": 1}
+
+	if expected, actual := "/api 12, /shuttle 3", sourceTopText(2, tally); expected != actual {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestReportSeconds(t *testing.T) {
+	cfg := &Config{ReportInt: 10 * time.Second}
+
+	if s := reportSeconds(cfg, &Report{Final: true, Interval: 2500 * time.Millisecond}); s != 2.5 {
+		t.Errorf("Expected the actual interval of %v s, got %v", 2.5, s)
+	}
+	if s := reportSeconds(cfg, &Report{}); s != 10 {
+		t.Errorf("Expected the configured interval of %v s, got %v", 10, s)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// Relative error of latency quantiles, a quantile of 200ms is between 198ms and 202ms.
+	quantileAccuracy = 0.01
+
+	// Latencies up to quantileMin are counted together, there are ~1100 bins between it and an hour.
+	quantileMin = time.Microsecond
+)
+
+var (
+	quantileGamma    = (1 + quantileAccuracy) / (1 - quantileAccuracy)
+	quantileLogGamma = math.Log(quantileGamma)
+)
+
+// Quantiles is a mergeable latency sketch, values are counted in logarithmic bins,
+// so any quantile is estimated within quantileAccuracy of its value, in memory bounded by the range of values.
+type Quantiles struct {
+	Count int
+	Max   time.Duration
+
+	bins map[int]int // bin index -> count, bin i holds values in (gamma^(i-1), gamma^i] microseconds
+	low  int         // values up to quantileMin
+}
+
+// LatencyStats is a summary of request latencies.
+type LatencyStats struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// NewQuantiles returns an empty sketch.
+func NewQuantiles() *Quantiles {
+	return &Quantiles{
+		bins: make(map[int]int),
+	}
+}
+
+// Add registers a latency.
+func (q *Quantiles) Add(d time.Duration) {
+	q.Count++
+	if d > q.Max {
+		q.Max = d
+	}
+
+	if d <= quantileMin {
+		q.low++
+		return
+	}
+	q.bins[quantileBin(d)]++
+}
+
+// Merge adds latencies of another sketch.
+func (q *Quantiles) Merge(o *Quantiles) {
+	if o == nil {
+		return
+	}
+
+	q.Count += o.Count
+	q.low += o.low
+	if o.Max > q.Max {
+		q.Max = o.Max
+	}
+	for i, c := range o.bins {
+		q.bins[i] += c
+	}
+}
+
+// reset forgets all latencies.
+func (q *Quantiles) reset() {
+	q.Count, q.Max, q.low = 0, 0, 0
+	for i := range q.bins {
+		delete(q.bins, i)
+	}
+}
+
+// Quantile returns an estimated latency below which fraction r of latencies is, ex. 0.99.
+func (q *Quantiles) Quantile(r float64) time.Duration {
+	return q.quantiles(r)[0]
+}
+
+// Stats returns p50, p90, p95, p99 and max latencies, nil if there are none.
+func (q *Quantiles) Stats() *LatencyStats {
+	if q == nil || q.Count == 0 {
+		return nil
+	}
+
+	v := q.quantiles(0.5, 0.9, 0.95, 0.99)
+	return &LatencyStats{P50: v[0], P90: v[1], P95: v[2], P99: v[3], Max: q.Max}
+}
+
+// quantiles returns estimates of ascending fractions rs in one pass over the bins.
+func (q *Quantiles) quantiles(rs ...float64) []time.Duration {
+	out := make([]time.Duration, len(rs))
+	if q.Count == 0 {
+		return out
+	}
+
+	idx := make([]int, 0, len(q.bins))
+	for i := range q.bins {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	seen := q.low
+	j := 0
+	for ; j < len(rs) && float64(seen) > rs[j]*float64(q.Count-1); j++ {
+		out[j] = quantileMin
+	}
+	for _, i := range idx {
+		seen += q.bins[i]
+		for ; j < len(rs) && float64(seen) > rs[j]*float64(q.Count-1); j++ {
+			out[j] = quantileValue(i)
+		}
+	}
+
+	// Estimates never exceed the actual max.
+	for k := range out {
+		if out[k] > q.Max {
+			out[k] = q.Max
+		}
+	}
+
+	return out
+}
+
+// quantileBin returns an index of the bin of d.
+func quantileBin(d time.Duration) int {
+	return int(math.Ceil(math.Log(float64(d)/float64(time.Microsecond)) / quantileLogGamma))
+}
+
+// quantileValue returns a value of bin i, within quantileAccuracy of every value in the bin.
+func quantileValue(i int) time.Duration {
+	us := 2 * math.Pow(quantileGamma, float64(i)) / (quantileGamma + 1)
+	return time.Duration(us * float64(time.Microsecond))
+}
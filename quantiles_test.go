@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestQuantiles(t *testing.T) {
+	q := NewQuantiles()
+	rnd := rand.New(rand.NewSource(1))
+
+	// Long-tailed latencies from 1ms to ~10s.
+	var exact []time.Duration
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(float64(time.Millisecond) * (1 + rnd.ExpFloat64()*rnd.ExpFloat64()*50))
+		q.Add(d)
+		exact = append(exact, d)
+	}
+	sort.Slice(exact, func(i, j int) bool { return exact[i] < exact[j] })
+
+	for _, r := range []float64{0.5, 0.9, 0.95, 0.99} {
+		expected := exact[int(r*float64(len(exact)-1))]
+		actual := q.Quantile(r)
+		if diff := float64(actual-expected) / float64(expected); diff > quantileAccuracy || diff < -quantileAccuracy {
+			t.Errorf("p%v: expected %s within %v, got %s", r*100, expected, quantileAccuracy, actual)
+		}
+	}
+
+	if q.Max != exact[len(exact)-1] || q.Stats().Max != q.Max {
+		t.Errorf("Expected max %s, got %s", exact[len(exact)-1], q.Max)
+	}
+}
+
+func TestQuantiles_Merge(t *testing.T) {
+	a, b := NewQuantiles(), NewQuantiles()
+	for i := 1; i <= 50; i++ {
+		a.Add(time.Duration(i) * time.Millisecond)
+		b.Add(time.Duration(i+50) * time.Millisecond)
+	}
+	a.Merge(b)
+
+	st := a.Stats()
+	if a.Count != 100 || st.Max != 100*time.Millisecond {
+		t.Errorf("Expected 100 latencies up to 100ms, got %d up to %s", a.Count, st.Max)
+	}
+	if st.P50 < 49*time.Millisecond || st.P50 > 51*time.Millisecond {
+		t.Errorf("Expected p50 of ~50ms, got %s", st.P50)
+	}
+
+	if NewQuantiles().Stats() != nil {
+		t.Error("Expected no stats of an empty sketch")
+	}
+}
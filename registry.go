@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defStateInterval = 10 * time.Second
+	defMaxReplay     = 64 << 20 // bytes
+)
+
+// registryEntry is a read position of one log file.
+type registryEntry struct {
+	Dev    uint64    `json:"dev"`
+	Ino    uint64    `json:"ino"`
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"` // when the offset was saved
+}
+
+// Registry keeps read offsets of log files in a state file, so reading resumes after a restart.
+// Files are identified by device and inode, a file replaced at the same path is read from the end.
+type Registry struct {
+	path    string
+	entries map[string]registryEntry // by file name
+}
+
+// NewRegistry returns a Registry loading a state file if it exists.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:    path,
+		entries: make(map[string]registryEntry),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &r.entries); err != nil {
+		return nil, fmt.Errorf("Cannot read state file %s: %s", path, err.Error())
+	}
+
+	return r, nil
+}
+
+// Resume returns an offset to start reading a file from and a note describing the decision.
+// At most maxReplay bytes are replayed, 0 - no limit. Skipped tells that the offset
+// was moved forward by the limit and can point to the middle of a line.
+func (r *Registry) Resume(name string, fi os.FileInfo, maxReplay int64) (offset int64, skipped bool, note string) {
+	size := fi.Size()
+
+	e, ok := r.entries[name]
+	if !ok {
+		return size, false, ""
+	}
+
+	dev, ino, ok := fileID(fi)
+	if !ok || dev != e.Dev || ino != e.Ino {
+		return size, false, fmt.Sprintf("Log file %s was replaced since the last run, reading from the end.", name)
+	}
+
+	offset = e.Offset
+	if offset > size {
+		// Truncated in place.
+		offset = 0
+	}
+
+	if maxReplay > 0 && size-offset > maxReplay {
+		return size - maxReplay, true, fmt.Sprintf("Log file %s: backlog of %d bytes exceeds the replay limit, skipping %d bytes.",
+			name, size-offset, size-maxReplay-offset)
+	}
+
+	return offset, false, fmt.Sprintf("Log file %s: resuming from offset %d, replaying %d bytes.", name, offset, size-offset)
+}
+
+// Set records a read offset of a file.
+func (r *Registry) Set(name string, fi os.FileInfo, offset int64, t time.Time) {
+	dev, ino, ok := fileID(fi)
+	if !ok {
+		return
+	}
+
+	r.entries[name] = registryEntry{
+		Dev:    dev,
+		Ino:    ino,
+		Offset: offset,
+		Time:   t,
+	}
+}
+
+// Save writes the state file, replacing it atomically.
+func (r *Registry) Save() error {
+	b, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(r.path, b)
+}
+
+// writeFileAtomic writes a file through a temporary one, so readers never see it partially written.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
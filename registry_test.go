@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(log, []byte(strings.Repeat("x", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := fileID(fi); !ok {
+		t.Skip("File identity is not supported on this platform")
+	}
+
+	state := filepath.Join(dir, "state.json")
+	r, err := NewRegistry(state)
+	if err != nil {
+		t.Fatalf("NewRegistry should not fail on a missing file. Error: %+v", err)
+	}
+
+	// Unknown file is read from the end.
+	if offset, _, _ := r.Resume(log, fi, 0); offset != 100 {
+		t.Errorf("Expected offset %d, got %d", 100, offset)
+	}
+
+	r.Set(log, fi, 40, time.Now())
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save should not fail. Error: %+v", err)
+	}
+
+	r, err = NewRegistry(state)
+	if err != nil {
+		t.Fatalf("NewRegistry should not fail. Error: %+v", err)
+	}
+
+	if offset, skipped, _ := r.Resume(log, fi, 0); offset != 40 || skipped {
+		t.Errorf("Expected offset %d, got %d", 40, offset)
+	}
+
+	// Replay limit.
+	if offset, skipped, _ := r.Resume(log, fi, 10); offset != 90 || !skipped {
+		t.Errorf("Expected offset %d skipped, got %d, %v", 90, offset, skipped)
+	}
+
+	// Replaced file has another inode.
+	e := r.entries[log]
+	e.Ino++
+	r.entries[log] = e
+
+	if offset, _, note := r.Resume(log, fi, 0); offset != 100 || note == "" {
+		t.Errorf("Expected offset %d for a replaced file, got %d", 100, offset)
+	}
+}
+
+func TestRegistry_Truncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "access.log")
+	ioutil.WriteFile(log, []byte(strings.Repeat("x", 100)), 0644)
+
+	fi, _ := os.Stat(log)
+	if _, _, ok := fileID(fi); !ok {
+		t.Skip("File identity is not supported on this platform")
+	}
+
+	r, _ := NewRegistry(filepath.Join(dir, "state.json"))
+	r.Set(log, fi, 80, time.Now())
+
+	os.Truncate(log, 10)
+	fi, _ = os.Stat(log)
+
+	if offset, _, _ := r.Resume(log, fi, 0); offset != 0 {
+		t.Errorf("Expected offset %d for a truncated file, got %d", 0, offset)
+	}
+}
+
+func TestNewRegistry_Corrupted(t *testing.T) {
+	f, err := ioutil.TempFile("", "htm-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("{")
+	f.Close()
+
+	if _, err := NewRegistry(f.Name()); err == nil {
+		t.Error("Expected an error reading a corrupted state file")
+	}
+}
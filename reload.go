@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reloadPath    = "/-/reload"
+	reloadTimeout = 5 * time.Second // how long a reload waits for the monitor to pick it up
+)
+
+// reloadRestart lists Config fields which cannot be changed without a restart,
+// new values of these fields are reported and ignored.
+var reloadRestart = map[string]bool{
+	"AdminAddr":     true,
+	"APIAddr":       true,
+	"APIRetention":  true,
+	"Files":         true,
+	"HeavyHitters":  true,
+	"HTTPAddr":      true,
+	"LogFormat":     true,
+	"MaxKeys":       true,
+	"MaxPolls":      true,
+	"MaxReplay":     true,
+	"MetricsAddr":   true,
+	"MTF":           true,
+	"PollInt":       true,
+	"SnapshotFile":  true,
+	"StateFile":     true,
+	"StateInterval": true,
+	"SyslogAddr":    true,
+	"UI":            true,
+	"Visitors":      true,
+	"Watch":         true,
+	"Windows":       true,
+}
+
+// reloadSinkFields are prefixes of Config fields external sinks are created from.
+var reloadSinkFields = []string{"Graphite", "Influx", "OTLP", "Statsd"}
+
+// reloadResult describes an outcome of a configuration reload.
+type reloadResult struct {
+	Applied []string `json:"applied"`           // changes in effect, ex. "AlertThreshold: 1000 -> 200"
+	Restart []string `json:"restart,omitempty"` // changes ignored until restart
+	Error   string   `json:"error,omitempty"`
+}
+
+// reloadRequest hands a validated configuration or a reason it cannot be applied over to Monitor.
+type reloadRequest struct {
+	cfg      *Config
+	err      error
+	result   *reloadResult
+	sinks    []Sink // new external sinks, nil if sinks are not changed
+	oldSinks []Sink // external sinks to replace
+	done     chan struct{}
+}
+
+// Reloader re-reads configuration on SIGHUP or an admin request
+// and passes changes to Monitor, which applies them between polls.
+// Accumulated frames and alert states are preserved.
+type Reloader struct {
+	mu    sync.Mutex // serializes reloads
+	args  []string
+	cfgMu sync.RWMutex
+	cfg   *Config // configuration in effect, guarded by cfgMu
+	sinks []Sink  // external sinks created from cfg
+	reqs  chan<- *reloadRequest
+}
+
+// NewReloader returns a Reloader reading configuration with the same arguments the monitor was started with.
+func NewReloader(args []string, cfg *Config, sinks []Sink, reqs chan<- *reloadRequest) *Reloader {
+	return &Reloader{
+		args:  args,
+		cfg:   cfg,
+		sinks: sinks,
+		reqs:  reqs,
+	}
+}
+
+// Reload reads and validates configuration and waits until Monitor applies it.
+// Errors are passed to Monitor as well, so a reload on SIGHUP is not silent.
+func (rl *Reloader) Reload() *reloadResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	req := &reloadRequest{
+		done: make(chan struct{}),
+	}
+
+	req.err = rl.prepare(req)
+
+	select {
+	case rl.reqs <- req:
+	case <-time.After(reloadTimeout):
+		closeSinks(req.sinks)
+		return &reloadResult{Error: "Monitor is not running."}
+	}
+	<-req.done
+
+	if req.err != nil {
+		return &reloadResult{Error: req.err.Error()}
+	}
+
+	if req.sinks != nil {
+		// Old sinks may still be sending queued samples.
+		go closeSinks(rl.sinks)
+		rl.sinks = req.sinks
+	}
+	rl.cfgMu.Lock()
+	rl.cfg = req.cfg
+	rl.cfgMu.Unlock()
+
+	return req.result
+}
+
+// Config returns the configuration in effect, the one Monitor has applied by the last reload.
+func (rl *Reloader) Config() *Config {
+	rl.cfgMu.RLock()
+	defer rl.cfgMu.RUnlock()
+
+	return rl.cfg
+}
+
+// prepare reads configuration, merges it with the current one and creates sinks if their settings changed.
+func (rl *Reloader) prepare(req *reloadRequest) error {
+	next, err := NewConfig(rl.args)
+	if err != nil {
+		return err
+	}
+
+	req.cfg, req.result = mergeConfig(rl.cfg, next)
+
+	if err := validateRunningRules(req.cfg); err != nil {
+		return err
+	}
+
+	if sinksChanged(req.result.Applied) {
+		req.sinks, err = NewSinks(req.cfg)
+		if err != nil {
+			return err
+		}
+		req.oldSinks = rl.sinks
+	}
+
+	return nil
+}
+
+// ServeHTTP handles an admin reload request, POST only.
+func (rl *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res := rl.Reload()
+
+	w.Header().Set("Content-Type", "application/json")
+	if res.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(res)
+}
+
+// mergeConfig returns a configuration to apply and the list of changes.
+// Fields which require a restart keep their current values.
+func mergeConfig(cur, next *Config) (*Config, *reloadResult) {
+	out := *next
+	res := &reloadResult{Applied: []string{}}
+
+	cv := reflect.ValueOf(cur).Elem()
+	ov := reflect.ValueOf(&out).Elem()
+
+	for i := 0; i < ov.NumField(); i++ {
+		name := ov.Type().Field(i).Name
+		a, b := cv.Field(i).Interface(), ov.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		change := fmt.Sprintf("%s: %v -> %v", name, a, b)
+		if reloadRestart[name] {
+			res.Restart = append(res.Restart, change)
+			ov.Field(i).Set(cv.Field(i))
+			continue
+		}
+
+		res.Applied = append(res.Applied, change)
+	}
+
+	return &out, res
+}
+
+// validateRunningRules checks rules of a merged configuration against windows, visitors and log format
+// it keeps from the running one, new values of these wait for a restart and cannot feed rules yet.
+func validateRunningRules(cfg *Config) error {
+	visitors := cfg.Visitors != "" && cfg.Visitors != visitorsOff
+	metrics := ruleMetricsFor(cfg.Windows, visitors, logsLatency(cfg.LogFormat))
+
+	var problems []string
+	for i := range cfg.Rules {
+		problems = append(problems, cfg.Rules[i].validate(metrics)...)
+	}
+	if len(problems) > 0 {
+		problems = append(problems, "Rules are checked against windows, visitors and log format in effect, changes of these require a restart.")
+		return &ValidationError{problems}
+	}
+
+	return nil
+}
+
+// sinksChanged tells whether any of changes affects external sinks.
+func sinksChanged(changes []string) bool {
+	for _, c := range changes {
+		for _, p := range reloadSinkFields {
+			if strings.HasPrefix(c, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
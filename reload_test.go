@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeConfig(t *testing.T) {
+	cur := &Config{AlertThreshold: 10, Files: []string{"a.log"}, PollInt: 1, TopN: 5}
+	next := &Config{AlertThreshold: 20, Files: []string{"b.log"}, PollInt: 1, TopN: 5, StatsdAddr: "127.0.0.1:8125"}
+
+	out, res := mergeConfig(cur, next)
+
+	expected := &Config{AlertThreshold: 20, Files: []string{"a.log"}, PollInt: 1, TopN: 5, StatsdAddr: "127.0.0.1:8125"}
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %+v, got %+v", expected, out)
+	}
+
+	applied := []string{"AlertThreshold: 10 -> 20", "StatsdAddr:  -> 127.0.0.1:8125"}
+	if !reflect.DeepEqual(applied, res.Applied) {
+		t.Errorf("Expected applied %q, got %q", applied, res.Applied)
+	}
+
+	restart := []string{"Files: [a.log] -> [b.log]"}
+	if !reflect.DeepEqual(restart, res.Restart) {
+		t.Errorf("Expected restart %q, got %q", restart, res.Restart)
+	}
+
+	if !sinksChanged(res.Applied) || sinksChanged(res.Restart) {
+		t.Error("Only StatsdAddr change should affect sinks")
+	}
+}
+
+func TestSession_Configure(t *testing.T) {
+	s := NewSession(2, time.Second, nil)
+	s.State = stateAlert
+	s.Rules = []*Rule{{Name: "errors", Metric: metricHits5xx, Threshold: 1}, {Name: "gone", Metric: metricHits, Threshold: 1}}
+	s.RuleStates = map[string]uint8{"errors": stateAlert, "gone": stateAlert}
+
+	s.Configure(&Config{
+		AlertThreshold: 5,
+		Rules:          []Rule{{Name: "errors", Metric: metricHits5xx, Threshold: 3}},
+	})
+
+	if s.AlertThreshold != 5 || s.State != stateAlert {
+		t.Errorf("Expected threshold %d in alert state, got %v in %d", 5, s.AlertThreshold, s.State)
+	}
+
+	expected := map[string]uint8{ruleTraffic: stateAlert, "errors": stateAlert}
+	if actual := s.States(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected states %+v, got %+v", expected, actual)
+	}
+	if s.Rules[0].Threshold != 3 {
+		t.Errorf("Expected rule threshold %d, got %v", 3, s.Rules[0].Threshold)
+	}
+}
+
+// testSink counts samples sent.
+type testSink struct {
+	sent int
+}
+
+func (s *testSink) Send(smp *Sample) error {
+	s.sent++
+	return nil
+}
+
+func TestSession_ReplaceSinks(t *testing.T) {
+	fixed, old, new := &testSink{}, &testSink{}, &testSink{}
+
+	s := NewSession(2, time.Second, nil)
+	s.Sinks = []Sink{fixed, old}
+	s.ReplaceSinks([]Sink{old}, []Sink{new})
+
+	if len(s.Sinks) != 2 || s.Sinks[0] != fixed || s.Sinks[1] != new {
+		t.Errorf("Unexpected sinks %+v", s.Sinks)
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	path := writeTestConfig(t, "log_file = \"access.log\"\nalert_threshold = 10\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	args := []string{"--config", path}
+	cfg, err := NewConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := make(chan *reloadRequest)
+	msgChan := make(chan msg, 1)
+	rl := NewReloader(args, cfg, nil, reqs)
+
+	// Monitor side.
+	go func() {
+		for req := range reqs {
+			if req.err != nil {
+				msgChan <- msgErr(req.err)
+			} else {
+				msgChan <- msgReload(req.cfg, req.result)
+			}
+			close(req.done)
+		}
+	}()
+	defer close(reqs)
+
+	writeConfigFile(t, path, "log_file = \"other.log\"\nalert_threshold = 20\n")
+
+	w := httptest.NewRecorder()
+	rl.ServeHTTP(w, httptest.NewRequest(http.MethodPost, reloadPath, nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "AlertThreshold: 10 -> 20") {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	m := <-msgChan
+	if m.msgType != msgTypeReload || m.config.AlertThreshold != 20 || m.config.Files[0] != "access.log" {
+		t.Errorf("Unexpected reload message %+v", m)
+	}
+	if rl.Config() != m.config {
+		t.Error("Expected the applied configuration in effect")
+	}
+
+	// Invalid configuration is not applied.
+	writeConfigFile(t, path, "alert_threshold = \"high\"\n")
+
+	res := rl.Reload()
+	if res.Error == "" {
+		t.Error("Expected a validation error")
+	}
+	if m := <-msgChan; m.msgType != msgTypeError {
+		t.Errorf("Expected %s message, got %s", msgTypeError, m.msgType)
+	}
+	if rl.Config().AlertThreshold != 20 {
+		t.Errorf("Expected threshold %v in effect, got %v", 20, rl.Config().AlertThreshold)
+	}
+
+	// Rules on windows which are not running yet are not applied.
+	writeConfigFile(t, path, "log_file = \"access.log\"\nalert_threshold = 30\nwindows = \"30m\"\n\n[[rules]]\nname = \"slow\"\nmetric = \"rate_30m\"\nthreshold = 5\n")
+
+	if res := rl.Reload(); !strings.Contains(res.Error, "rate_30m") {
+		t.Errorf("Expected a rule on a window not running rejected, got %+v", res)
+	}
+	if m := <-msgChan; m.msgType != msgTypeError {
+		t.Errorf("Expected %s message, got %s", msgTypeError, m.msgType)
+	}
+	if rl.Config().AlertThreshold != 20 {
+		t.Errorf("Expected threshold %v in effect, got %v", 20, rl.Config().AlertThreshold)
+	}
+
+	w = httptest.NewRecorder()
+	rl.ServeHTTP(w, httptest.NewRequest(http.MethodGet, reloadPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d on GET, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+// ring is a fixed-size buffer of the latest points with their running sum,
+// a point is added in O(1) and without allocations regardless of the size.
+type ring struct {
+	buf    []int
+	next   int // slot the next point goes to
+	filled int // points recorded so far, up to len(buf)
+	sum    int
+}
+
+// newRing returns an empty ring of size points, at least one.
+func newRing(size int) ring {
+	if size < 1 {
+		size = 1
+	}
+	return ring{buf: make([]int, size)}
+}
+
+// add records the next point, the oldest one is dropped when the ring is full.
+func (r *ring) add(v int) {
+	r.sum += v - r.buf[r.next]
+	r.buf[r.next] = v
+	r.next = (r.next + 1) % len(r.buf)
+
+	if r.filled < len(r.buf) {
+		r.filled++
+	}
+}
+
+// addLast adds v to the latest point.
+func (r *ring) addLast(v int) {
+	if r.filled == 0 {
+		r.add(v)
+		return
+	}
+
+	r.buf[(r.next-1+len(r.buf))%len(r.buf)] += v
+	r.sum += v
+}
+
+// skip records n empty points, more than the ring holds just empties it.
+func (r *ring) skip(n int64) {
+	if n > int64(len(r.buf)) {
+		n = int64(len(r.buf))
+	}
+
+	for i := int64(0); i < n; i++ {
+		r.add(0)
+	}
+}
+
+// each calls fn for every recorded point, oldest first.
+func (r *ring) each(fn func(v int)) {
+	first := (r.next - r.filled + len(r.buf)) % len(r.buf)
+	for i := 0; i < r.filled; i++ {
+		fn(r.buf[(first+i)%len(r.buf)])
+	}
+}
+
+// reset drops all points keeping the buffer.
+func (r *ring) reset() {
+	for i := range r.buf {
+		r.buf[i] = 0
+	}
+	r.next, r.filled, r.sum = 0, 0, 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	r.add(1)
+	r.addLast(1)
+	r.add(3)
+	r.add(4)
+	r.add(5) // the first point is dropped
+
+	var actual []int
+	r.each(func(v int) {
+		actual = append(actual, v)
+	})
+
+	if expected := []int{3, 4, 5}; !reflect.DeepEqual(expected, actual) || r.sum != 12 {
+		t.Errorf("Expected points %v with sum %d, got %v with %d", expected, 12, actual, r.sum)
+	}
+
+	r.skip(5)
+	if r.sum != 0 || r.filled != 3 {
+		t.Errorf("Expected a full ring of zeros after a gap, got %+v", r)
+	}
+
+	r.reset()
+	r.each(func(v int) {
+		t.Errorf("Expected no points after reset, got %d", v)
+	})
+}
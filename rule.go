@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Metrics available to alert rules, all are evaluated at every poll.
+
+	metricAvgTraffic     = "avg_traffic" // average hits per second during MTF
+	metricHits           = "hits"        // hits since last poll
+	metricBandwidth      = "bandwidth"   // bytes sent per second since last poll
+	metricBytes          = "bytes"       // bytes sent since last poll
+	metricHits4xx        = "hits_4xx"    // 4xx responses since last poll
+	metricHits5xx        = "hits_5xx"    // 5xx responses since last poll
+	metricLatencyPrefix  = "latency_"    // latency quantile over a rolling window, ex. "latency_p99_5m"
+	metricRatePrefix     = "rate_"       // hits per second over a rolling window, ex. "rate_5m"
+	metricVisitorsPrefix = "visitors_"   // distinct visitors over a rolling window, ex. "visitors_1m"
+)
+
+// latencyQuantiles lists latency quantiles available to rules, in the order of latencyValues.
+var latencyQuantiles = []string{"p50", "p90", "p95", "p99", "max"}
+
+// ruleMetrics lists metrics accepted in rule definitions, rolling window metrics excluded.
+var ruleMetrics = []string{
+	metricAvgTraffic,
+	metricBandwidth,
+	metricBytes,
+	metricHits,
+	metricHits4xx,
+	metricHits5xx,
+}
+
+// Rule is an alert rule, an alert is raised when a metric reaches the threshold
+// and recovered when it drops below it.
+// The built-in "traffic" rule is configured with AlertThreshold, others come from a configuration file.
+type Rule struct {
+	Name      string
+	Metric    string // metric*
+	Threshold float64
+}
+
+// ruleMetricsFor returns metrics accepted in rule definitions with rates of given windows,
+// their latencies if the log format has a request time and their distinct visitors if they are counted.
+func ruleMetricsFor(windows []time.Duration, visitors, latency bool) []string {
+	out := append([]string(nil), ruleMetrics...)
+	for _, w := range windows {
+		out = append(out, windowMetric(w))
+	}
+	if latency {
+		for _, w := range windows {
+			out = append(out, latencyMetrics(w)...)
+		}
+	}
+	if visitors {
+		for _, w := range windows {
+			out = append(out, visitorMetric(w))
+		}
+	}
+	return out
+}
+
+// validate returns problems of a rule definition, metrics lists accepted metrics.
+func (r *Rule) validate(metrics []string) []string {
+	var out []string
+
+	if r.Name == "" {
+		out = append(out, "Rule name is not provided.")
+	} else if r.Name == ruleTraffic {
+		out = append(out, fmt.Sprintf("Rule name %q is reserved for the built-in traffic rule, use alert_threshold to configure it.", ruleTraffic))
+	}
+
+	known := false
+	for _, m := range metrics {
+		if r.Metric == m {
+			known = true
+			break
+		}
+	}
+	if !known {
+		out = append(out, fmt.Sprintf("Rule %q: unknown metric %q, allowed: %v.", r.Name, r.Metric, metrics))
+	}
+
+	if r.Threshold <= 0 {
+		out = append(out, fmt.Sprintf("Rule %q: threshold must be positive.", r.Name))
+	}
+
+	return out
+}
+
+// latencyValues returns latencies of latencyQuantiles, zeros if st is nil.
+func latencyValues(st *LatencyStats) []time.Duration {
+	if st == nil {
+		return make([]time.Duration, len(latencyQuantiles))
+	}
+	return []time.Duration{st.P50, st.P90, st.P95, st.P99, st.Max}
+}
+
+// ruleValues returns current values of metrics rules refer to.
+// Estimates over visitor and latency windows merge all their buckets, so they are made only for metrics in use.
+// Latencies are in seconds, 0 if there were none.
+func ruleValues(rules []*Rule, f *Frame, poll *Tally, visitors []*VisitorWindow, latency []*LatencyWindow) map[string]float64 {
+	used := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		used[r.Metric] = true
+	}
+
+	out := map[string]float64{
+		metricAvgTraffic: f.AvgTraffic,
+		metricBandwidth:  float64(poll.Bytes) / f.Res.Seconds(),
+		metricBytes:      float64(poll.Bytes),
+		metricHits:       float64(poll.Hits),
+		metricHits4xx:    float64(poll.StatusCodes[4]),
+		metricHits5xx:    float64(poll.StatusCodes[5]),
+	}
+
+	for _, w := range f.Windows {
+		if m := windowMetric(w.Len); used[m] {
+			out[m] = w.Rate()
+		}
+	}
+
+	for _, w := range visitors {
+		if m := visitorMetric(w.Len); used[m] {
+			out[m] = float64(w.Count())
+		}
+	}
+
+	for _, w := range latency {
+		names := latencyMetrics(w.Len)
+
+		inUse := false
+		for _, m := range names {
+			inUse = inUse || used[m]
+		}
+		if !inUse {
+			continue
+		}
+
+		for i, v := range latencyValues(w.Stats()) {
+			out[names[i]] = v.Seconds()
+		}
+	}
+
+	return out
+}
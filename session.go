@@ -3,34 +3,65 @@ package main
 import (
 	"errors"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/satyrius/gonx"
 )
 
+const (
+	// Client identities distinct visitors are counted by.
+
+	visitorsIP   = "ip"    // remote address
+	visitorsIPUA = "ip+ua" // remote address and user agent, tells apart clients behind one NAT
+	visitorsOff  = "off"
+)
+
 // Session represents a monitoring session and handles all accumulated data.
 type Session struct {
-	AlertThreshold int
-	Entries        []*Entry
-	File           *os.File
+	AlertSince     map[string]time.Time // start of open alerts by rule, created on first alert
+	AlertThreshold float64
+	HeavyHitters   int      // Space-Saving capacity of section counters, 0 - exact counts
+	MaxKeys        int      // distinct keys kept per counter, see Tally.MaxKeys
+	Metrics        *Metrics // optional, nil unless metrics are exported
 	Parser         *gonx.Parser
-	PollInt        int
+	Patterns       []string // glob patterns new log files are discovered by
+	Poll           *Tally   // entries added since last poll, created on first entry
+	PollInt        time.Duration
+	Registry       *Registry             // read offsets persisted across restarts, nil if disabled
+	Reload         <-chan *reloadRequest // configuration reloads, nil if disabled
 	Report         *Report
-	State          uint8
+	Rules          []*Rule          // alert rules in addition to the built-in traffic rule
+	RuleStates     map[string]uint8 // states of Rules, created on first change
+	Sinks          []Sink
+	Sources        []Source
+	SourceStates   map[string]uint8 // per source traffic alert states, created on first change
+	State          uint8            // state of the built-in traffic rule
+	Visitors       string           // visitors*, distinct visitors are not counted if empty
 }
 
 // Report accumulates data for reports.
 type Report struct {
-	StatusCodes    map[uint8]int // 4 status code groups: 2xx, 3xx, 4xx, 5xx
-	Time           *time.Time
-	TopSectionHits map[int]Pair
-	TotalHits      int
+	Final              bool              // last report on shutdown, its interval can be shorter
+	Interval           time.Duration     // time the report covers, 0 - unknown
+	SectionErrors      map[string]int    // heavy hitters mode: maximum overestimation of top section counts, nil for exact counts
+	SectionBytesErrors map[string]int    // heavy hitters mode: maximum overestimation of bytes of top sections by bytes
+	Sources            map[string]*Tally // entries by source, created on first entry
+	StatusCodes        map[uint8]int     // 4 status code groups: 2xx, 3xx, 4xx, 5xx
+	Tally              *Tally            // all entries of the interval, created on first entry
+	Time               *time.Time
+	TopSectionBytes    map[int]Pair // top sections by bytes sent
+	TopSectionHits     map[int]Pair
+	TotalHits          int
+
+	SectionVisitors map[string]int // estimated distinct visitors of top sections, nil unless counted
+	Visitors        int            // estimated distinct visitors
+
+	Latency        *LatencyStats            // nil if latency is not logged
+	SectionLatency map[string]*LatencyStats // latency of top sections, nil if latency is not logged
 }
 
 // NewSession returns a new Session object.
-func NewSession(threshold, pollInt int, p *gonx.Parser) *Session {
+func NewSession(threshold float64, pollInt time.Duration, p *gonx.Parser) *Session {
 	return &Session{
 		AlertThreshold: threshold,
 		Parser:         p,
@@ -40,24 +71,66 @@ func NewSession(threshold, pollInt int, p *gonx.Parser) *Session {
 	}
 }
 
-// SetLog adds file to the session.
+// SetLog adds a log file read from its end to the session, "-" and named pipes are read as streams.
 func (s *Session) SetLog(f string) error {
-	var err error
 	if f == "" {
 		return errors.New("No file provided")
 	}
-	s.File, err = os.Open(f)
+
+	var src Source
+	var err error
+
+	if isStream(f) {
+		src, err = OpenStreamSource(f)
+	} else {
+		src, err = OpenFileSource(f)
+	}
 	if err != nil {
 		return err
 	}
+	s.Sources = append(s.Sources, src)
 
 	return nil
 }
 
-// Close closes log file opened for this session.
+// Discover opens log files matching Patterns which are not read yet.
+// New files are read from their end.
+func (s *Session) Discover() ([]*FileSource, error) {
+	if len(s.Patterns) == 0 {
+		return nil, nil
+	}
+
+	names, err := globFiles(s.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(s.Sources))
+	for _, src := range s.Sources {
+		known[src.Name()] = true
+	}
+
+	var out []*FileSource
+	for _, name := range names {
+		if known[name] {
+			continue
+		}
+
+		src, err := OpenFileSource(name)
+		if err != nil {
+			return out, err
+		}
+		s.Sources = append(s.Sources, src)
+		out = append(out, src)
+	}
+
+	return out, nil
+}
+
+// Close closes all sources of the session.
 func (s *Session) Close() {
-	if s.File != nil {
-		s.File.Close()
+	for _, src := range s.Sources {
+		src.Close()
 	}
 }
 
@@ -70,17 +143,23 @@ func NewReport(t *time.Time) *Report {
 			3: 0,
 			2: 0,
 		},
-		Time:           t,
-		TopSectionHits: make(map[int]Pair),
+		Time:            t,
+		TopSectionBytes: make(map[int]Pair),
+		TopSectionHits:  make(map[int]Pair),
 	}
 }
 
 // ConsumeLines receives log entries accumulated since last poll,
 // converts them into Entry objects and adds to the session buffer.
 func (s *Session) ConsumeLines(l []string) error {
+	return s.ConsumeSourceLines("", l)
+}
+
+// ConsumeSourceLines is ConsumeLines for entries of a named source.
+func (s *Session) ConsumeSourceLines(src string, l []string) error {
 	for _, line := range l {
 
-		err := s.AddLine(line)
+		err := s.AddSourceLine(src, line)
 		if err != nil {
 			return fmt.Errorf(" Error adding log entry %s \n Err: %s ", line, err.Error())
 		}
@@ -91,30 +170,133 @@ func (s *Session) ConsumeLines(l []string) error {
 
 // AddLine adds a log entry as an Entry object to the session buffer.
 func (s *Session) AddLine(line string) error {
+	return s.AddSourceLine("", line)
+}
+
+// AddSourceLine is AddLine for an entry of a named source.
+func (s *Session) AddSourceLine(src, line string) error {
 
 	r := NewEntry(s.Parser)
 	err := r.ParseLine(line)
 	if err != nil {
+		if s.Metrics != nil {
+			s.Metrics.ObserveParseError()
+		}
 		return err
 	}
+	r.Source = src
+	r.Visitor = s.visitor(r)
+
+	if s.Metrics != nil {
+		s.Metrics.ObserveEntry(r)
+	}
+
+	if s.Poll == nil {
+		s.Poll = s.newPollTally()
+		if s.countsVisitors() {
+			// Poll sketches feed rolling visitor windows, sections are counted by reports only.
+			s.Poll.Visitors = NewHLL(hllWindowPrecision)
+		}
+	}
+	s.Poll.Add(r)
+
+	if s.Report.Tally == nil {
+		s.Report.Tally = s.newTally()
+		s.Report.Tally.CountSectionLatency()
+		if s.countsVisitors() {
+			s.Report.Tally.CountVisitors()
+		}
+	}
+	s.Report.Tally.Add(r)
+
+	if src != "" {
+		if s.Report.Sources == nil {
+			s.Report.Sources = make(map[string]*Tally)
+		}
+		if s.Report.Sources[src] == nil {
+			// Syslog hosts are not known in advance, they are limited like any other key.
+			if s.MaxKeys > 0 && len(s.Report.Sources) >= s.MaxKeys {
+				src = otherKey
+			}
+			if s.Report.Sources[src] == nil {
+				s.Report.Sources[src] = s.newTally()
+			}
+		}
+		s.Report.Sources[src].Add(r)
+	}
 
-	s.Entries = append(s.Entries, r)
 	s.Report.TotalHits++
 
 	return nil
 }
 
+// countsVisitors tells whether distinct visitors are counted.
+func (s *Session) countsVisitors() bool {
+	return s.Visitors != "" && s.Visitors != visitorsOff
+}
+
+// visitor returns an identity of the client of an entry, empty if visitors are not counted.
+func (s *Session) visitor(e *Entry) string {
+	switch {
+	case e.RemoteAddr == "":
+		return ""
+	case s.Visitors == visitorsIP:
+		return e.RemoteAddr
+	case s.Visitors == visitorsIPUA:
+		return e.RemoteAddr + " " + e.UserAgent
+	}
+	return ""
+}
+
+// newTally returns an empty Tally limited to MaxKeys.
+func (s *Session) newTally() *Tally {
+	t := NewTally()
+	t.MaxKeys = s.MaxKeys
+	if s.HeavyHitters > 0 {
+		t.Top = NewTopK(s.HeavyHitters)
+		t.TopBytes = NewTopK(s.HeavyHitters)
+	}
+	return t
+}
+
+// newPollTally returns an empty Tally of a poll limited to MaxKeys.
+// Polls count the sections of one poll exactly, they are kept by history for long
+// and sketches of their own would only hold memory nobody reports from.
+func (s *Session) newPollTally() *Tally {
+	t := NewTally()
+	t.MaxKeys = s.MaxKeys
+	return t
+}
+
 // FlushReport returns interval report and resets accumulated stats.
 func (s *Session) FlushReport(cfg *Config, t *time.Time) *Report {
 
 	s.GetSectionHits(cfg.TopN) // sets i.Summary.TopSectionHits
 
+	s.GetSectionBytes(cfg.TopN) // sets i.Summary.TopSectionBytes
+
 	s.GetStatusCodes() // sets i.Summary.StatusCodes
 
+	s.GetVisitors() // sets i.Summary.Visitors
+
+	s.GetLatency() // sets i.Summary.Latency
+
 	out := NewReport(t)
 
 	out.TotalHits = s.Report.TotalHits
 
+	out.Tally = s.Report.Tally
+	if out.Tally == nil {
+		out.Tally = s.newTally()
+	}
+	out.Sources = s.Report.Sources
+	out.SectionErrors = s.Report.SectionErrors
+	out.SectionBytesErrors = s.Report.SectionBytesErrors
+	out.SectionVisitors = s.Report.SectionVisitors
+	out.Visitors = s.Report.Visitors
+	out.Latency = s.Report.Latency
+	out.SectionLatency = s.Report.SectionLatency
+
 	for k, v := range s.Report.StatusCodes {
 		out.StatusCodes[k] = v
 	}
@@ -123,50 +305,48 @@ func (s *Session) FlushReport(cfg *Config, t *time.Time) *Report {
 		out.TopSectionHits[k] = v
 	}
 
+	for k, v := range s.Report.TopSectionBytes {
+		out.TopSectionBytes[k] = v
+	}
+
 	s.reset()
 
 	return out
 }
 
+// FlushPoll returns a tally of entries added since last poll and starts a new one.
+func (s *Session) FlushPoll() *Tally {
+	out := s.Poll
+	if out == nil {
+		out = s.newPollTally()
+	}
+
+	s.Poll = nil
+
+	return out
+}
+
 // reset nullifies traffic data accumulated since last report.
 func (s *Session) reset() {
 	s.Report = NewReport(nil)
-	s.Entries = []*Entry{}
 }
 
-// GetStatusCodes calculates status code summary.
+// GetStatusCodes calculates status code summary from counters of the interval.
 func (s *Session) GetStatusCodes() {
+	if s.Report.Tally == nil {
+		return
+	}
 
-	for _, e := range s.Entries {
-		i, err := strconv.Atoi(e.StatusCode[0:1])
-		if err != nil {
-			// todo: add error-logging
-			continue
-		}
-		codeGroup := uint8(i)
-		_, ok := s.Report.StatusCodes[codeGroup]
-		if !ok {
-			s.Report.StatusCodes[codeGroup] = 1
-		} else {
-			s.Report.StatusCodes[codeGroup]++
-		}
+	for g, v := range s.Report.Tally.StatusCodes {
+		s.Report.StatusCodes[g] = v
 	}
 }
 
 // GetSectionHits calculates top n section hits during the interval poll time.
 func (s *Session) GetSectionHits(n uint) {
-
-	sectionHits := make(map[string]int, len(s.Entries))
-
-	// Get hits by section.
-	for _, e := range s.Entries {
-
-		_, ok := sectionHits[e.Section]
-		if !ok {
-			sectionHits[e.Section] = 1
-		} else {
-			sectionHits[e.Section]++
-		}
+	var sectionHits map[string]int
+	if s.Report.Tally != nil {
+		sectionHits = s.Report.Tally.Sections
 	}
 
 	// Sort.
@@ -174,10 +354,70 @@ func (s *Session) GetSectionHits(n uint) {
 
 	// Limit to top n.
 	s.Report.TopSectionHits = CutTopN(sorted, n)
+
+	if s.Report.Tally != nil && s.Report.Tally.Top != nil {
+		s.Report.SectionErrors = make(map[string]int, len(s.Report.TopSectionHits))
+		for _, p := range s.Report.TopSectionHits {
+			s.Report.SectionErrors[p.Key] = s.Report.Tally.Top.Err(p.Key)
+		}
+	}
+}
+
+// GetSectionBytes calculates top n sections by bytes sent during the interval.
+func (s *Session) GetSectionBytes(n uint) {
+	if s.Report.Tally == nil {
+		return
+	}
+
+	sectionBytes := make(map[string]int, len(s.Report.Tally.SectionBytes))
+	for k, v := range s.Report.Tally.SectionBytes {
+		sectionBytes[k] = int(v)
+	}
+
+	s.Report.TopSectionBytes = CutTopN(RankByHits(sectionBytes), n)
+
+	if s.Report.Tally.TopBytes != nil {
+		s.Report.SectionBytesErrors = make(map[string]int, len(s.Report.TopSectionBytes))
+		for _, p := range s.Report.TopSectionBytes {
+			s.Report.SectionBytesErrors[p.Key] = s.Report.Tally.TopBytes.Err(p.Key)
+		}
+	}
+}
+
+// GetVisitors estimates distinct visitors of the interval and of top sections.
+// GetSectionHits is expected to be called first.
+func (s *Session) GetVisitors() {
+	if s.Report.Tally == nil || s.Report.Tally.Visitors == nil {
+		return
+	}
+
+	s.Report.Visitors = s.Report.Tally.Visitors.Count()
+	s.Report.SectionVisitors = make(map[string]int, len(s.Report.TopSectionHits))
+	for _, p := range s.Report.TopSectionHits {
+		if h := s.Report.Tally.SectionVisitors[p.Key]; h != nil {
+			s.Report.SectionVisitors[p.Key] = h.Count()
+		}
+	}
+}
+
+// GetLatency calculates latency quantiles of the interval and of top sections.
+// GetSectionHits is expected to be called first.
+func (s *Session) GetLatency() {
+	if s.Report.Tally == nil || s.Report.Tally.Latency == nil {
+		return
+	}
+
+	s.Report.Latency = s.Report.Tally.Latency.Stats()
+	s.Report.SectionLatency = make(map[string]*LatencyStats, len(s.Report.TopSectionHits))
+	for _, p := range s.Report.TopSectionHits {
+		if st := s.Report.Tally.SectionLatency[p.Key].Stats(); st != nil {
+			s.Report.SectionLatency[p.Key] = st
+		}
+	}
 }
 
 // ShouldEscalate returns escalation action code.
-func (s *Session) ShouldEscalate(traffic int) bool {
+func (s *Session) ShouldEscalate(traffic float64) bool {
 
 	if !s.IsAlert() && traffic >= s.AlertThreshold {
 		s.SetAlert()
@@ -188,7 +428,7 @@ func (s *Session) ShouldEscalate(traffic int) bool {
 }
 
 // ShouldDeescalate returns escalation action code.
-func (s *Session) ShouldDeescalate(traffic int) bool {
+func (s *Session) ShouldDeescalate(traffic float64) bool {
 
 	if s.IsAlert() && traffic < s.AlertThreshold {
 		s.SetOK()
@@ -212,3 +452,148 @@ func (s *Session) SetAlert() {
 func (s *Session) SetOK() {
 	s.State = stateOK
 }
+
+// CheckRules evaluates alert rules against current metric values
+// and returns rules which changed their state to alert or back to OK.
+func (s *Session) CheckRules(values map[string]float64) (esc, deesc []*Rule) {
+	for _, r := range s.Rules {
+		v := values[r.Metric]
+		alert := s.RuleState(r.Name) == stateAlert
+
+		if !alert && v >= r.Threshold {
+			s.setRuleState(r.Name, stateAlert)
+			esc = append(esc, r)
+		}
+
+		if alert && v < r.Threshold {
+			s.setRuleState(r.Name, stateOK)
+			deesc = append(deesc, r)
+		}
+	}
+
+	return esc, deesc
+}
+
+// RuleState returns current state of a rule.
+func (s *Session) RuleState(name string) uint8 {
+	if name == ruleTraffic {
+		return s.State
+	}
+
+	st, ok := s.RuleStates[name]
+	if !ok {
+		return stateOK
+	}
+	return st
+}
+
+// States returns current state of every rule, the built-in one included.
+// With several sources, per source traffic rules are included too.
+func (s *Session) States() map[string]uint8 {
+	out := map[string]uint8{ruleTraffic: s.State}
+	for _, r := range s.Rules {
+		out[r.Name] = s.RuleState(r.Name)
+	}
+	if len(s.Sources) > 1 {
+		for _, src := range s.Sources {
+			out[sourceRule(src.Name())] = s.SourceStates[src.Name()]
+		}
+	}
+	return out
+}
+
+// CheckSource checks the traffic alert threshold against average traffic of a source
+// and tells whether the source changed its state to alert or back to OK.
+func (s *Session) CheckSource(name string, traffic float64) (esc, deesc bool) {
+	alert := s.SourceStates[name] == stateAlert
+
+	if !alert && traffic >= s.AlertThreshold {
+		esc = true
+	}
+
+	if alert && traffic < s.AlertThreshold {
+		deesc = true
+	}
+
+	if esc || deesc {
+		if s.SourceStates == nil {
+			s.SourceStates = make(map[string]uint8)
+		}
+		s.SourceStates[name] = stateOK
+		if esc {
+			s.SourceStates[name] = stateAlert
+		}
+	}
+
+	return esc, deesc
+}
+
+func (s *Session) hasRule(name string) bool {
+	for _, r := range s.Rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) setRuleState(name string, st uint8) {
+	if s.RuleStates == nil {
+		s.RuleStates = make(map[string]uint8)
+	}
+	s.RuleStates[name] = st
+}
+
+// Configure applies reloadable settings: alert threshold and rules.
+// States of rules which are still defined are kept.
+func (s *Session) Configure(cfg *Config) {
+	s.AlertThreshold = cfg.AlertThreshold
+
+	s.Rules = nil
+	names := make(map[string]bool, len(cfg.Rules))
+	for i := range cfg.Rules {
+		s.Rules = append(s.Rules, &cfg.Rules[i])
+		names[cfg.Rules[i].Name] = true
+	}
+
+	for name := range s.RuleStates {
+		if !names[name] {
+			delete(s.RuleStates, name)
+			delete(s.AlertSince, name)
+		}
+	}
+}
+
+// ReplaceSinks replaces old sinks with new ones keeping all other sinks.
+func (s *Session) ReplaceSinks(old, new []Sink) {
+	var out []Sink
+
+sinks:
+	for _, sink := range s.Sinks {
+		for _, o := range old {
+			if sink == o {
+				continue sinks
+			}
+		}
+		out = append(out, sink)
+	}
+
+	s.Sinks = append(out, new...)
+}
+
+// TrackAlerts records start time of newly opened alerts and forgets recovered ones.
+func (s *Session) TrackAlerts(t time.Time) {
+	for rule, st := range s.States() {
+		_, open := s.AlertSince[rule]
+
+		switch {
+		case st == stateAlert && !open:
+			if s.AlertSince == nil {
+				s.AlertSince = make(map[string]time.Time)
+			}
+			s.AlertSince[rule] = t
+		case st != stateAlert && open:
+			delete(s.AlertSince, rule)
+		}
+	}
+}
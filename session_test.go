@@ -2,17 +2,19 @@ package main
 
 import (
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/satyrius/gonx"
 )
 
 func TestNewInterval(t *testing.T) {
 
-	actual := NewSession(2, 2, nil)
+	actual := NewSession(2, 2*time.Second, nil)
 	expected := &Session{
 		AlertThreshold: 2,
-		PollInt:        2,
+		PollInt:        2 * time.Second,
 		Report: &Report{
 			StatusCodes: map[uint8]int{
 				5: 0,
@@ -20,7 +22,8 @@ func TestNewInterval(t *testing.T) {
 				3: 0,
 				2: 0,
 			},
-			TopSectionHits: make(map[int]Pair),
+			TopSectionBytes: make(map[int]Pair),
+			TopSectionHits:  make(map[int]Pair),
 		},
 		State: stateOK,
 	}
@@ -38,7 +41,7 @@ func TestNewInterval(t *testing.T) {
 func TestInterval_AddEntry(t *testing.T) {
 
 	parser := gonx.NewParser(parserFormat)
-	s := NewSession(2, 2, parser)
+	s := NewSession(2, 2*time.Second, parser)
 
 	testString := `182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/technology/sts-newsref/srb.html HTTP/1.0" 200 49553`
 
@@ -52,7 +55,7 @@ func TestInterval_AddEntry(t *testing.T) {
 	}
 
 	expected := 2
-	actual := len(s.Entries)
+	actual := s.Report.TotalHits
 
 	if expected != actual {
 		t.Errorf("Should have %d entries, got %v", expected, actual)
@@ -62,7 +65,7 @@ func TestInterval_AddEntry(t *testing.T) {
 func TestInterval_GetSectionHits(t *testing.T) {
 
 	parser := gonx.NewParser(parserFormat)
-	s := NewSession(2, 2, parser)
+	s := NewSession(2, 2*time.Second, parser)
 	var err error
 
 	// Section: /shuttle
@@ -119,7 +122,7 @@ func TestInterval_GetSectionHits(t *testing.T) {
 func TestInterval_GetStatusCodes(t *testing.T) {
 
 	parser := gonx.NewParser(parserFormat)
-	s := NewSession(2, 2, parser)
+	s := NewSession(2, 2*time.Second, parser)
 	var err error
 
 	// Code: 200
@@ -169,34 +172,191 @@ func TestInterval_GetStatusCodes(t *testing.T) {
 
 func TestSession_ShouldEscalate_True(t *testing.T) {
 
-	threshold := 1
-	s := NewSession(threshold, 2, nil)
+	threshold := 1.0
+	s := NewSession(threshold, 2*time.Second, nil)
 	s.SetOK()
 
 	expected := true
 
-	traffic := 2
+	traffic := 2.0
 
 	actual := s.ShouldEscalate(traffic) // traffic = 2, threshold = 1
 
 	if actual != expected {
-		t.Errorf("UpdateState(%d, %d): expected %d, actual %d", traffic, threshold, expected, actual)
+		t.Errorf("UpdateState(%v, %v): expected %d, actual %d", traffic, threshold, expected, actual)
 	}
 }
 
 func TestSession_ShouldEscalate_False(t *testing.T) {
 
-	threshold := 3
-	s := NewSession(threshold, 2, nil)
+	threshold := 3.0
+	s := NewSession(threshold, 2*time.Second, nil)
 	s.SetOK()
 
 	expected := false
 
-	traffic := 2
+	traffic := 2.0
 
 	actual := s.ShouldEscalate(traffic) // traffic = 2, threshold = 1
 
 	if actual != expected {
-		t.Errorf("UpdateState(%d, %d): expected %t, actual %t", traffic, threshold, expected, actual)
+		t.Errorf("UpdateState(%v, %v): expected %t, actual %t", traffic, threshold, expected, actual)
+	}
+}
+
+func TestSession_CheckRules(t *testing.T) {
+	s := NewSession(2, 2*time.Second, nil)
+	s.Rules = []*Rule{
+		{Name: "errors", Metric: metricHits5xx, Threshold: 3},
+		{Name: "volume", Metric: metricHits, Threshold: 10},
+	}
+
+	esc, deesc := s.CheckRules(map[string]float64{metricHits5xx: 3, metricHits: 5})
+	if len(esc) != 1 || esc[0].Name != "errors" || len(deesc) != 0 {
+		t.Errorf("Expected errors rule escalation, got %+v, %+v", esc, deesc)
+	}
+
+	// No repeated escalation while in the alert state.
+	esc, deesc = s.CheckRules(map[string]float64{metricHits5xx: 4, metricHits: 5})
+	if len(esc) != 0 || len(deesc) != 0 {
+		t.Errorf("Expected no changes, got %+v, %+v", esc, deesc)
+	}
+
+	esc, deesc = s.CheckRules(map[string]float64{metricHits5xx: 0, metricHits: 5})
+	if len(esc) != 0 || len(deesc) != 1 || deesc[0].Name != "errors" {
+		t.Errorf("Expected errors rule recovery, got %+v, %+v", esc, deesc)
+	}
+
+	s.State = stateAlert
+	expected := map[string]uint8{ruleTraffic: stateAlert, "errors": stateOK, "volume": stateOK}
+	if actual := s.States(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected states %+v, got %+v", expected, actual)
+	}
+}
+
+func TestSession_MaxKeys(t *testing.T) {
+	s := NewSession(2, time.Second, gonx.NewParser(parserFormat))
+	s.MaxKeys = 1
+
+	for _, src := range []string{"a.log", "b.log"} {
+		for _, section := range []string{"/shuttle", "/shuttle", "/images"} {
+			line := `182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET ` + section + `/index.html HTTP/1.0" 200 49553`
+			if err := s.AddSourceLine(src, line); err != nil {
+				t.Fatalf("AddSourceLine should not fail. Error: %+v", err)
+			}
+		}
+	}
+
+	r := s.FlushReport(&Config{TopN: 5}, nil)
+
+	expected := map[int]Pair{0: {"/shuttle", 4}, 1: {otherKey, 2}}
+	if !reflect.DeepEqual(expected, r.TopSectionHits) || r.TotalHits != 6 {
+		t.Errorf("Expected sections %v of %d hits, got %v of %d", expected, 6, r.TopSectionHits, r.TotalHits)
+	}
+
+	if len(r.Sources) != 2 || r.Sources["a.log"].Hits != 3 || r.Sources[otherKey].Hits != 3 {
+		t.Errorf("Expected the second source counted as %q, got %+v", otherKey, r.Sources)
+	}
+}
+
+func TestSession_HeavyHitters(t *testing.T) {
+	s := NewSession(2, time.Second, gonx.NewParser(parserFormat))
+	s.HeavyHitters = 1
+
+	for _, section := range []string{"/shuttle", "/shuttle", "/images"} {
+		line := `182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET ` + section + `/index.html HTTP/1.0" 200 49553`
+		if err := s.AddSourceLine("", line); err != nil {
+			t.Fatalf("AddSourceLine should not fail. Error: %+v", err)
+		}
+	}
+
+	poll := s.FlushPoll()
+	expected := map[string]int{"/shuttle": 2, "/images": 1}
+	if poll.Top != nil || poll.TopBytes != nil || !reflect.DeepEqual(expected, poll.Sections) {
+		t.Errorf("Expected exact poll sections %v without sketches, got %v", expected, poll.Sections)
+	}
+
+	r := s.FlushReport(&Config{TopN: 1}, nil)
+	if len(r.Tally.Sections) != 1 || r.Tally.Top == nil {
+		t.Errorf("Expected report sections counted by a sketch of 1 counter, got %v", r.Tally.Sections)
+	}
+}
+
+func TestSession_Visitors(t *testing.T) {
+	parser := gonx.NewParser(`$remote_addr - - [$time_local] "$request" $status $bytes_sent "$http_user_agent"`)
+
+	lines := []string{
+		`10.0.0.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/index.html HTTP/1.0" 200 100 "curl"`,
+		`10.0.0.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/index.html HTTP/1.0" 200 100 "Mozilla"`,
+		`10.0.0.2 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/index.html HTTP/1.0" 200 100 "curl"`,
+		`10.0.0.2 - - [28/Jul/1995:13:16:47 -0400] "GET /images/logo.gif HTTP/1.0" 200 100 "curl"`,
+	}
+
+	for mode, expected := range map[string]int{visitorsIP: 2, visitorsIPUA: 3} {
+		s := NewSession(2, time.Second, parser)
+		s.Visitors = mode
+		if err := s.ConsumeLines(lines); err != nil {
+			t.Fatalf("ConsumeLines should not fail. Error: %+v", err)
+		}
+
+		if poll := s.FlushPoll(); poll.Visitors == nil || poll.Visitors.Count() != expected {
+			t.Errorf("%s: expected %d visitors in the poll, got %+v", mode, expected, poll.Visitors)
+		}
+
+		r := s.FlushReport(&Config{TopN: 5}, nil)
+		if r.Visitors != expected || r.SectionVisitors["/shuttle"] != expected || r.SectionVisitors["/images"] != 1 {
+			t.Errorf("%s: expected %d visitors, got %d, by section %v", mode, expected, r.Visitors, r.SectionVisitors)
+		}
+	}
+}
+
+func TestSession_Bandwidth(t *testing.T) {
+	s := NewSession(2, time.Second, gonx.NewParser(parserFormat))
+
+	lines := []string{
+		`182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/index.html HTTP/1.0" 200 100`,
+		`182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /shuttle/index.html HTTP/1.0" 200 100`,
+		`182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /images/hubble.jpg HTTP/1.0" 200 1000`,
+		`182.198.120.1 - - [28/Jul/1995:13:16:47 -0400] "GET /images/logo.gif HTTP/1.0" 304 -`,
+	}
+	if err := s.ConsumeLines(lines); err != nil {
+		t.Fatalf("ConsumeLines should not fail. Error: %+v", err)
+	}
+
+	r := s.FlushReport(&Config{TopN: 5}, nil)
+
+	expected := map[int]Pair{0: {"/images", 1000}, 1: {"/shuttle", 200}}
+	if !reflect.DeepEqual(expected, r.TopSectionBytes) {
+		t.Errorf("Expected sections by bytes %v, got %v", expected, r.TopSectionBytes)
+	}
+
+	if r.Tally.Bytes != 1200 || r.Tally.MaxBytes != 1000 || r.Tally.AvgBytes() != 300 {
+		t.Errorf("Expected 1200 bytes, max 1000, avg 300, got %d, %d, %v", r.Tally.Bytes, r.Tally.MaxBytes, r.Tally.AvgBytes())
+	}
+}
+
+func TestSession_Latency(t *testing.T) {
+	s := NewSession(2, time.Second, gonx.NewParser(`"$request" $status $bytes_sent $request_time`))
+
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		section := "/shuttle"
+		if i > 90 {
+			section = "/images"
+		}
+		lines = append(lines, `"GET `+section+`/index.html HTTP/1.0" 200 100 `+strconv.FormatFloat(float64(i)/1000, 'f', -1, 64))
+	}
+	if err := s.ConsumeLines(lines); err != nil {
+		t.Fatalf("ConsumeLines should not fail. Error: %+v", err)
+	}
+
+	r := s.FlushReport(&Config{TopN: 5}, nil)
+
+	if r.Latency == nil || r.Latency.Max != 100*time.Millisecond || r.Latency.P90 < 89*time.Millisecond || r.Latency.P90 > 91*time.Millisecond {
+		t.Errorf("Expected p90 of ~90ms and max of 100ms, got %+v", r.Latency)
+	}
+
+	if st := r.SectionLatency["/images"]; st == nil || st.P50 < 94*time.Millisecond || st.P50 > 97*time.Millisecond {
+		t.Errorf("Expected p50 of /images of ~95ms, got %+v", st)
 	}
 }
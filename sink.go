@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Sample kinds.
+
+	sampleKindPoll   = "poll"
+	sampleKindReport = "report"
+
+	sinkQueueLen = 64 // samples waiting for a network sink, newer ones are dropped
+)
+
+// Sample is a set of aggregates collected during one poll or report interval.
+type Sample struct {
+	AvgTraffic float64          // hits per second
+	Kind       string           // sampleKind*
+	States     map[string]uint8 // alert rule name -> state*
+	Tally      *Tally
+	Time       time.Time
+}
+
+// Sink is a receiver of samples, ex. an external metrics system.
+type Sink interface {
+	Send(smp *Sample) error
+}
+
+// NewSinks creates external metrics sinks enabled in the configuration.
+func NewSinks(cfg *Config) ([]Sink, error) {
+	var out []Sink
+
+	if cfg.StatsdAddr != "" {
+		sd, err := NewStatsdSink(cfg.StatsdAddr, cfg.StatsdPrefix, cfg.StatsdTags)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sd)
+	}
+
+	if cfg.InfluxURL != "" {
+		out = append(out, NewAsyncSink(NewInfluxHTTPSink(cfg.InfluxURL, cfg.InfluxMeas)))
+	}
+
+	if cfg.InfluxFile != "" {
+		inf, err := NewInfluxFileSink(cfg.InfluxFile, cfg.InfluxMeas)
+		if err != nil {
+			closeSinks(out)
+			return nil, err
+		}
+		out = append(out, inf)
+	}
+
+	if cfg.GraphiteAddr != "" {
+		out = append(out, NewAsyncSink(NewGraphiteSink(cfg.GraphiteAddr, cfg.GraphitePrefix)))
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		attrs := map[string]string{"log.file.path": strings.Join(cfg.Files, ",")}
+		for k, v := range cfg.OTLPAttrs {
+			attrs[k] = v
+		}
+		// Totals are counted before the queue, a dropped sample is covered by the next one.
+		out = append(out, NewCumulativeSink(NewAsyncSink(NewOTLPSink(cfg.OTLPEndpoint, attrs))))
+	}
+
+	return out, nil
+}
+
+// AsyncSink sends samples to a slow sink, ex. a remote collector, in its own goroutine,
+// so the monitor never waits for network. Samples are queued up to sinkQueueLen,
+// the ones which don't fit are dropped and counted.
+type AsyncSink struct {
+	sink  Sink
+	queue chan *Sample
+	done  chan struct{}
+
+	mu      sync.Mutex
+	dropped int   // samples dropped since the last report
+	err     error // the last send error since the last report
+}
+
+// NewAsyncSink starts sending samples queued for sink.
+func NewAsyncSink(sink Sink) *AsyncSink {
+	s := &AsyncSink{
+		sink:  sink,
+		queue: make(chan *Sample, sinkQueueLen),
+		done:  make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Send queues a sample without blocking.
+// Errors of earlier samples and the number of dropped ones are returned by the next Send.
+func (s *AsyncSink) Send(smp *Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case s.queue <- smp:
+	default:
+		s.dropped++
+	}
+
+	return s.takeErr()
+}
+
+// Close sends queued samples, closes the sink and returns errors since the last Send.
+func (s *AsyncSink) Close() error {
+	close(s.queue)
+	<-s.done
+
+	var err error
+	if c, ok := s.sink.(io.Closer); ok {
+		err = c.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if serr := s.takeErr(); serr != nil {
+		err = serr
+	}
+	return err
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+
+	for smp := range s.queue {
+		if err := s.sink.Send(smp); err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+	}
+}
+
+// takeErr returns and forgets the last error and dropped samples, mu must be held.
+func (s *AsyncSink) takeErr() error {
+	err := s.err
+	switch {
+	case s.dropped > 0 && s.err != nil:
+		err = fmt.Errorf("Sink is too slow, %d sample(s) dropped, last error: %v", s.dropped, s.err)
+	case s.dropped > 0:
+		err = fmt.Errorf("Sink is too slow, %d sample(s) dropped.", s.dropped)
+	}
+
+	s.err, s.dropped = nil, 0
+	return err
+}
+
+// CumulativeSink passes poll samples to a sink with tallies replaced by hits, bytes and status codes
+// accumulated since start, for sinks exporting cumulative sums. Report samples are skipped
+// as their hits are already counted by polls.
+type CumulativeSink struct {
+	sink  Sink
+	total *Tally
+}
+
+// NewCumulativeSink starts accumulating totals for sink.
+func NewCumulativeSink(sink Sink) *CumulativeSink {
+	return &CumulativeSink{sink: sink, total: NewTally()}
+}
+
+// Send adds a poll sample to totals and sends a copy of the sample holding totals.
+func (s *CumulativeSink) Send(smp *Sample) error {
+	if smp.Kind != sampleKindPoll {
+		return nil
+	}
+
+	s.total.Hits += smp.Tally.Hits
+	s.total.Bytes += smp.Tally.Bytes
+	for g, v := range smp.Tally.StatusCodes {
+		s.total.StatusCodes[g] += v
+	}
+
+	// The sample may be sent later, it gets totals of its own.
+	total := NewTally()
+	total.Hits = s.total.Hits
+	total.Bytes = s.total.Bytes
+	for g, v := range s.total.StatusCodes {
+		total.StatusCodes[g] = v
+	}
+
+	out := *smp
+	out.Tally = total
+	return s.sink.Send(&out)
+}
+
+// Close closes the sink.
+func (s *CumulativeSink) Close() error {
+	if c, ok := s.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// closeSinks closes sinks holding connections or files.
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		if c, ok := sink.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// formatFloat formats a metric value with the precision it has, ex. 2 or 0.25.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// namePart converts a value into a dot-separated metric name segment, ex. "/shuttle" -> "shuttle".
+func namePart(v string) string {
+	v = strings.Trim(v, "/")
+	if v == "" {
+		return "root"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, v)
+}
+
+// sortedCounts returns keys of a counter map in alphabetical order.
+func sortedCounts(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamePart(t *testing.T) {
+	tests := map[string]string{
+		"/shuttle":     "shuttle",
+		"/":            "root",
+		"/htbin?x=1.2": "htbin_x_1_2",
+	}
+
+	for in, expected := range tests {
+		actual := namePart(in)
+		if expected != actual {
+			t.Errorf("namePart(%s): expected %s, actual %s", in, expected, actual)
+		}
+	}
+}
+
+// gatedSink blocks in Send until the gate is closed.
+type gatedSink struct {
+	gate chan struct{}
+	sent int
+}
+
+func (s *gatedSink) Send(smp *Sample) error {
+	<-s.gate
+	s.sent++
+	return nil
+}
+
+func TestAsyncSink(t *testing.T) {
+	slow := &gatedSink{gate: make(chan struct{})}
+	sink := NewAsyncSink(slow)
+	smp := &Sample{Kind: sampleKindPoll, Tally: NewTally()}
+
+	// One sample is taken by the sender, the queue is full after sinkQueueLen more.
+	var err error
+	for i := 0; i < sinkQueueLen+3; i++ {
+		err = sink.Send(smp)
+	}
+	if err == nil {
+		t.Error("Expected dropped samples reported")
+	}
+
+	close(slow.gate)
+	if err := sink.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if slow.sent < sinkQueueLen || slow.sent > sinkQueueLen+1 {
+		t.Errorf("Expected queued samples sent on close, got %d", slow.sent)
+	}
+}
+
+// lastSink keeps the last sample sent.
+type lastSink struct {
+	last *Sample
+}
+
+func (s *lastSink) Send(smp *Sample) error {
+	s.last = smp
+	return nil
+}
+
+func TestCumulativeSink(t *testing.T) {
+	last := &lastSink{}
+	sink := NewCumulativeSink(last)
+
+	// Any sample sent holds totals of all polls before it, so a dropped one is covered by the next.
+	var polls []*Tally
+	for i := 0; i < 3; i++ {
+		poll := NewTally()
+		poll.Hits = 2
+		poll.Bytes = 100
+		poll.StatusCodes[5] = 1
+		polls = append(polls, poll)
+
+		if err := sink.Send(&Sample{Kind: sampleKindPoll, Tally: poll}); err != nil {
+			t.Fatalf("Send should not fail. Error: %+v", err)
+		}
+	}
+	sink.Send(&Sample{Kind: sampleKindReport, Tally: polls[0]})
+
+	actual := last.last.Tally
+	if actual.Hits != 6 || actual.Bytes != 300 || !reflect.DeepEqual(map[uint8]int{5: 3}, actual.StatusCodes) {
+		t.Errorf("Expected totals of all polls, got %+v", actual)
+	}
+	if polls[2].Hits != 2 || polls[2] == actual {
+		t.Errorf("Expected samples of polls left unchanged, got %+v", polls[2])
+	}
+}
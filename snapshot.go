@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshot is a persisted state of traffic frames and alerts,
+// restored at startup so a restart during an incident does not reset averages and alert states.
+type snapshot struct {
+	Time       time.Time            `json:"time"`
+	PollInt    time.Duration        `json:"pollInterval"`
+	Points     []int                `json:"points"`            // hits per poll, oldest first
+	Sources    map[string][]int     `json:"sources,omitempty"` // points by source
+	States     map[string]uint8     `json:"states"`            // alert rule name -> state*
+	AlertSince map[string]time.Time `json:"alertSince"`
+}
+
+// saveSnapshot writes a snapshot of the main frame and frames of sources, replacing the file atomically.
+func saveSnapshot(path string, f *Frame, frames map[string]*Frame, s *Session, pollInt time.Duration, t time.Time) error {
+	var sources map[string][]int
+	if len(frames) > 0 {
+		sources = make(map[string][]int, len(frames))
+		for name, sf := range frames {
+			sources[name] = sf.Points()
+		}
+	}
+
+	b, err := json.MarshalIndent(&snapshot{
+		Time:       t,
+		PollInt:    pollInt,
+		Points:     f.Points(),
+		Sources:    sources,
+		States:     s.States(),
+		AlertSince: s.AlertSince,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, b)
+}
+
+// loadSnapshot reads a snapshot file, nil is returned if it does not exist.
+func loadSnapshot(path string) (*snapshot, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sn snapshot
+	if err := json.Unmarshal(b, &sn); err != nil {
+		return nil, fmt.Errorf("Cannot read snapshot file %s: %s", path, err.Error())
+	}
+
+	return &sn, nil
+}
+
+// restore applies a snapshot to frames and a session and returns a note describing what was restored.
+// Points older than MTF are discarded, so are all points if the poll interval has changed.
+// States are restored for the traffic rule, rules which are still configured and sources still read.
+func (sn *snapshot) restore(f *Frame, frames map[string]*Frame, s *Session, cfg *Config, now time.Time) string {
+	points := sn.recent(sn.Points, cfg, now)
+	f.Restore(points)
+
+	for name, sf := range frames {
+		if p, ok := sn.Sources[name]; ok {
+			sf.Restore(sn.recent(p, cfg, now))
+		}
+	}
+
+	var open []string
+
+	sources := make(map[string]bool, len(s.Sources))
+	for _, src := range s.Sources {
+		sources[sourceRule(src.Name())] = true
+	}
+
+	for rule, st := range sn.States {
+		switch {
+		case rule == ruleTraffic:
+			s.State = st
+		case s.hasRule(rule):
+			s.setRuleState(rule, st)
+		case sources[rule] && len(s.Sources) > 1:
+			if s.SourceStates == nil {
+				s.SourceStates = make(map[string]uint8)
+			}
+			s.SourceStates[strings.TrimPrefix(rule, ruleTraffic+":")] = st
+		default:
+			continue
+		}
+
+		if st != stateAlert {
+			continue
+		}
+
+		since, ok := sn.AlertSince[rule]
+		if !ok {
+			since = sn.Time
+		}
+		if s.AlertSince == nil {
+			s.AlertSince = make(map[string]time.Time)
+		}
+		s.AlertSince[rule] = since
+
+		open = append(open, rule)
+	}
+
+	sort.Strings(open)
+
+	note := fmt.Sprintf("Snapshot of %s restored: %d points", sn.Time.Format(reportTimeFormat), len(points))
+	if len(open) > 0 {
+		note += ", alerts still open: " + strings.Join(open, ", ")
+	}
+
+	return note + "."
+}
+
+// recent returns points which are still within MTF at now, none if the poll interval has changed.
+func (sn *snapshot) recent(points []int, cfg *Config, now time.Time) []int {
+	if sn.PollInt != cfg.PollInt {
+		return nil
+	}
+
+	var out []int
+	age := now.Sub(sn.Time)
+
+	for i, p := range points {
+		if age+time.Duration(len(points)-1-i)*cfg.PollInt < cfg.MTF {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
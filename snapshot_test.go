@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshot_SaveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.json")
+	cfg := &Config{MTF: 4 * time.Second, PollInt: time.Second}
+	at := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	f := NewFrame(cfg.MTF, cfg.PollInt)
+	src := NewFrame(cfg.MTF, cfg.PollInt)
+	for i, p := range []int{1, 2, 3, 4} {
+		f.Rec(at.Add(time.Duration(i-3)*time.Second), p)
+		src.Rec(at.Add(time.Duration(i-3)*time.Second), p*10)
+	}
+
+	s := NewSession(2, time.Second, nil)
+	s.Rules = []*Rule{{Name: "errors", Metric: metricHits5xx, Threshold: 1}, {Name: "gone", Metric: metricHits, Threshold: 1}}
+	s.State = stateAlert
+	s.RuleStates = map[string]uint8{"errors": stateAlert, "gone": stateAlert}
+	s.AlertSince = map[string]time.Time{ruleTraffic: at.Add(-time.Minute), "errors": at, "gone": at}
+
+	if err := saveSnapshot(path, f, map[string]*Frame{"a.log": src}, s, cfg.PollInt, at); err != nil {
+		t.Fatalf("saveSnapshot should not fail. Error: %+v", err)
+	}
+
+	sn, err := loadSnapshot(path)
+	if err != nil || sn == nil {
+		t.Fatalf("loadSnapshot should not fail. Error: %+v", err)
+	}
+
+	// Restarted 2 seconds later without the "gone" rule.
+	f2 := NewFrame(cfg.MTF, cfg.PollInt)
+	src2 := NewFrame(cfg.MTF, cfg.PollInt)
+	s2 := NewSession(2, time.Second, nil)
+	s2.Rules = []*Rule{{Name: "errors", Metric: metricHits5xx, Threshold: 1}}
+
+	note := sn.restore(f2, map[string]*Frame{"a.log": src2}, s2, cfg, at.Add(2*time.Second))
+
+	// Points of the last 4 seconds: 2 seconds of downtime leave the 2 latest ones.
+	if expected := []int{3, 4}; !reflect.DeepEqual(expected, f2.Points()) {
+		t.Errorf("Expected points %v, got %v", expected, f2.Points())
+	}
+	if expected := []int{30, 40}; !reflect.DeepEqual(expected, src2.Points()) {
+		t.Errorf("Expected source points %v, got %v", expected, src2.Points())
+	}
+
+	expected := map[string]uint8{ruleTraffic: stateAlert, "errors": stateAlert}
+	if actual := s2.States(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected states %+v, got %+v", expected, actual)
+	}
+
+	if !s2.AlertSince[ruleTraffic].Equal(at.Add(-time.Minute)) || len(s2.AlertSince) != 2 {
+		t.Errorf("Unexpected open alerts %+v", s2.AlertSince)
+	}
+
+	if note != "Snapshot of 2017-02-06T01:48:10Z restored: 2 points, alerts still open: errors, traffic." {
+		t.Errorf("Unexpected note %q", note)
+	}
+}
+
+func TestLoadSnapshot_Missing(t *testing.T) {
+	sn, err := loadSnapshot(getTempLoc(".TestLoadSnapshot_Missing.json"))
+	if sn != nil || err != nil {
+		t.Errorf("Expected no snapshot and no error, got %+v, %v", sn, err)
+	}
+}
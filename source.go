@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	stdinName = "-" // log file name standing for stdin
+)
+
+// Source is an input of log lines, ex. a log file.
+type Source interface {
+	// Name identifies the source in reports and alerts.
+	Name() string
+
+	// Read returns lines added since the last read.
+	Read() ([]string, error)
+
+	Close() error
+}
+
+// HostSource is a Source receiving lines from several hosts, ex. over syslog.
+// Its lines are tagged with hostnames rather than the source name.
+type HostSource interface {
+	Source
+
+	// ReadHosts returns lines added since the last read by hostname.
+	ReadHosts() (map[string][]string, error)
+}
+
+// FileSource tails a log file. It follows rotation: a file renamed or removed and created again
+// at the same path is read to the end and reopened, a file truncated in place is read from the beginning.
+type FileSource struct {
+	path     string
+	file     *os.File
+	reader   *bufio.Reader
+	prevSize int64
+	offset   int64 // position of the next unread byte
+	lag      int64 // bytes left unread after the last read
+}
+
+// OpenFileSource opens a file for reading from its end.
+func OpenFileSource(path string) (*FileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &FileSource{
+		path:   path,
+		file:   f,
+		reader: bufio.NewReader(f),
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := src.SetOffset(stat.Size(), false); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return src, nil
+}
+
+// Name returns the file path.
+func (src *FileSource) Name() string {
+	return src.path
+}
+
+// SetOffset moves reading to offset, skipPartial drops the remainder of a line offset can point into.
+func (src *FileSource) SetOffset(offset int64, skipPartial bool) error {
+	if _, err := src.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	src.reader.Reset(src.file)
+	src.prevSize = offset
+	src.offset = offset
+
+	if skipPartial {
+		b, _ := src.reader.ReadBytes('\n')
+		src.offset += int64(len(b))
+	}
+
+	return nil
+}
+
+// Read returns lines added since the last read following rotation and truncation.
+func (src *FileSource) Read() ([]string, error) {
+	stat, err := src.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Truncated in place, ex. by logrotate copytruncate.
+	if stat.Size() < src.offset {
+		if err := src.SetOffset(0, false); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := src.readChange()
+	if err != nil {
+		return lines, err
+	}
+
+	// Rotated: the path points to another file now. The old one is read to the end above.
+	cur, err := os.Stat(src.path)
+	if err != nil || os.SameFile(cur, stat) {
+		// Missing path is a rotation in progress, the new file is picked up later.
+		return lines, nil
+	}
+
+	f, err := os.Open(src.path)
+	if err != nil {
+		return lines, nil
+	}
+
+	// Nothing is written to the old file anymore, its unterminated last line is complete.
+	rest, _ := ioutil.ReadAll(src.reader)
+	if line := strings.TrimSpace(string(rest)); line != "" {
+		lines = append(lines, line)
+	}
+
+	src.file.Close()
+	src.file = f
+	if err := src.SetOffset(0, false); err != nil {
+		return lines, err
+	}
+
+	more, err := src.readChange()
+	return append(lines, more...), err
+}
+
+// readChange reads lines the file has grown by.
+func (src *FileSource) readChange() ([]string, error) {
+	p := NewPoint(src.file, src.reader, src.prevSize)
+	err := p.GetChange()
+
+	src.prevSize = p.prevSize
+	if err == nil {
+		src.offset = p.offset
+		src.lag = p.lag
+	}
+
+	return p.lines, err
+}
+
+// Offset returns position of the next unread byte.
+func (src *FileSource) Offset() int64 {
+	return src.offset
+}
+
+// Lag returns a number of bytes left unread after the last read.
+func (src *FileSource) Lag() int64 {
+	return src.lag
+}
+
+// Stat returns information on the file being read.
+func (src *FileSource) Stat() (os.FileInfo, error) {
+	return src.file.Stat()
+}
+
+// Close closes the file.
+func (src *FileSource) Close() error {
+	return src.file.Close()
+}
+
+// StreamSource reads lines from stdin or a named pipe as they arrive.
+// Streams have no size to poll, so a goroutine reads lines into a buffer which Read drains.
+// A named pipe is opened again when its writer closes it, stdin is read until EOF.
+type StreamSource struct {
+	name  string
+	mu    sync.Mutex
+	file  *os.File
+	lines []string
+	err   error // reported once by Read
+	done  chan struct{}
+}
+
+// OpenStreamSource starts reading stdin if name is "-" or a named pipe otherwise.
+// Opening a pipe waits for a writer, so it is done in background.
+func OpenStreamSource(name string) (*StreamSource, error) {
+	src := &StreamSource{
+		name: name,
+		done: make(chan struct{}),
+	}
+
+	if name == stdinName {
+		src.file = os.Stdin
+		go func() {
+			src.consume(os.Stdin)
+			src.fail(errors.New("End of stdin, no more log lines will be read."))
+		}()
+		return src, nil
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		return nil, err
+	}
+
+	go src.follow()
+
+	return src, nil
+}
+
+// follow reads a named pipe opening it again for every writer until the source is closed.
+func (src *StreamSource) follow() {
+	for {
+		f, err := os.Open(src.name)
+		if err != nil {
+			src.fail(err)
+			return
+		}
+
+		src.mu.Lock()
+		closed := src.closed()
+		src.file = f
+		src.mu.Unlock()
+
+		if closed {
+			f.Close()
+			return
+		}
+
+		src.consume(f)
+		f.Close()
+
+		src.mu.Lock()
+		closed = src.closed()
+		src.mu.Unlock()
+
+		if closed {
+			return
+		}
+	}
+}
+
+// consume buffers lines read from r until EOF or an error.
+func (src *StreamSource) consume(r io.Reader) {
+	br := bufio.NewReader(r)
+
+	for {
+		data, err := br.ReadString('\n')
+
+		if line := strings.TrimSpace(data); line != "" {
+			src.mu.Lock()
+			src.lines = append(src.lines, line)
+			src.mu.Unlock()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// closed tells whether Close is called, the caller holds the lock.
+func (src *StreamSource) closed() bool {
+	select {
+	case <-src.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (src *StreamSource) fail(err error) {
+	src.mu.Lock()
+	src.err = err
+	src.mu.Unlock()
+}
+
+// Name returns "-" for stdin or the pipe path.
+func (src *StreamSource) Name() string {
+	return src.name
+}
+
+// Read returns lines received since the last read.
+func (src *StreamSource) Read() ([]string, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	lines, err := src.lines, src.err
+	src.lines, src.err = nil, nil
+
+	return lines, err
+}
+
+// Close stops reading the stream.
+func (src *StreamSource) Close() error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if src.closed() {
+		return nil
+	}
+	close(src.done)
+
+	if src.file != nil {
+		return src.file.Close()
+	}
+	return nil
+}
+
+// isStream tells whether a log file argument is stdin or a named pipe.
+func isStream(path string) bool {
+	if path == stdinName {
+		return true
+	}
+
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+}
+
+// isGlob tells whether a log file argument is a pattern.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFiles returns files matching patterns, sorted and without duplicates.
+func globFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			// Only regular files can be tailed, opening a named pipe would block.
+			if fi, err := os.Stat(m); err != nil || !fi.Mode().IsRegular() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			out = append(out, m)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
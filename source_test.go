@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSource_Read(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(log, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := OpenFileSource(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// Existing lines are skipped.
+	appendFile(t, log, "a\nb\n")
+	if lines, err := src.Read(); err != nil || !reflect.DeepEqual([]string{"a", "b"}, lines) {
+		t.Errorf("Expected appended lines, got %q, %v", lines, err)
+	}
+
+	// A line being written is read once it is terminated.
+	appendFile(t, log, "pa")
+	if lines, err := src.Read(); err != nil || len(lines) != 0 || src.Offset() != 8 || src.Lag() != 2 {
+		t.Errorf("Expected no lines and offset %d before a partial line, got %q at %d, %v", 8, lines, src.Offset(), err)
+	}
+	appendFile(t, log, "rt\n")
+	if lines, err := src.Read(); err != nil || !reflect.DeepEqual([]string{"part"}, lines) {
+		t.Errorf("Expected a terminated line, got %q, %v", lines, err)
+	}
+
+	// Truncated in place: read from the beginning.
+	if err := ioutil.WriteFile(log, []byte("c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := src.Read(); err != nil || !reflect.DeepEqual([]string{"c"}, lines) {
+		t.Errorf("Expected lines after truncation, got %q, %v", lines, err)
+	}
+
+	// Rotated: the rest of the old file and the new file are read, an unterminated last line too.
+	appendFile(t, log, "d")
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log, "e\n")
+
+	if lines, err := src.Read(); err != nil || !reflect.DeepEqual([]string{"d", "e"}, lines) {
+		t.Errorf("Expected lines across rotation, got %q, %v", lines, err)
+	}
+
+	if src.Offset() != 2 || src.Lag() != 0 {
+		t.Errorf("Expected offset %d and no lag, got %d and %d", 2, src.Offset(), src.Lag())
+	}
+}
+
+func TestSession_Discover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	appendFile(t, filepath.Join(dir, "a.log"), "x\n")
+	if err := os.Mkdir(filepath.Join(dir, "dir.log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSession(2, time.Second, nil)
+	s.Patterns = []string{filepath.Join(dir, "*.log"), filepath.Join(dir, "a.*")}
+	defer s.Close()
+
+	added, err := s.Discover()
+	if err != nil || len(added) != 1 || len(s.Sources) != 1 {
+		t.Fatalf("Expected 1 file discovered, got %d of %d sources, %v", len(added), len(s.Sources), err)
+	}
+
+	appendFile(t, filepath.Join(dir, "b.log"), "y\n")
+
+	added, err = s.Discover()
+	if err != nil || len(added) != 1 || added[0].Name() != filepath.Join(dir, "b.log") {
+		t.Fatalf("Expected b.log discovered, got %v, %v", added, err)
+	}
+
+	if added, _ = s.Discover(); len(added) != 0 || len(s.Sources) != 2 {
+		t.Errorf("Expected no files discovered twice, got %d and %d sources", len(added), len(s.Sources))
+	}
+}
+
+func TestSession_CheckSource(t *testing.T) {
+	s := NewSession(2, time.Second, nil)
+	s.Sources = []Source{&FileSource{path: "a.log"}, &FileSource{path: "b.log"}}
+
+	if esc, _ := s.CheckSource("a.log", 3); !esc {
+		t.Error("Expected a.log alert to escalate")
+	}
+	if esc, deesc := s.CheckSource("b.log", 1); esc || deesc {
+		t.Error("Expected b.log state unchanged")
+	}
+
+	expected := map[string]uint8{ruleTraffic: stateOK, "traffic:a.log": stateAlert, "traffic:b.log": stateOK}
+	if !reflect.DeepEqual(expected, s.States()) {
+		t.Errorf("Expected states %v, got %v", expected, s.States())
+	}
+
+	if _, deesc := s.CheckSource("a.log", 1); !deesc {
+		t.Error("Expected a.log alert to deescalate")
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamSource_Read(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	src, err := OpenStreamSource(stdinName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	w.WriteString("a\n\nb\n")
+	w.Close()
+
+	// Lines arrive in background, end of stream is reported once.
+	var lines []string
+	var errs int
+	for i := 0; i < 100 && errs == 0; i++ {
+		l, err := src.Read()
+		lines = append(lines, l...)
+		if err != nil {
+			errs++
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !reflect.DeepEqual([]string{"a", "b"}, lines) || errs != 1 {
+		t.Errorf("Expected 2 lines and end of stream, got %q and %d errors", lines, errs)
+	}
+
+	if l, err := src.Read(); l != nil || err != nil {
+		t.Errorf("Expected nothing after end of stream, got %q, %v", l, err)
+	}
+}
@@ -7,3 +7,14 @@ const (
 	//StateWarning uint8 = 1
 	stateOK uint8 = 0
 )
+
+const (
+	// Alert rule names.
+
+	ruleTraffic = "traffic" // average traffic over the monitoring time frame
+)
+
+// sourceRule returns a name of the traffic rule of one source, ex. "traffic:/var/log/a.log".
+func sourceRule(src string) string {
+	return ruleTraffic + ":" + src
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// Max payload of a StatsD datagram, fits into a typical Ethernet MTU.
+	statsdMaxPacket = 1432
+)
+
+// StatsdSink pushes samples to a StatsD server over UDP.
+type StatsdSink struct {
+	conn   net.Conn
+	prefix string
+	tags   bool // use DogStatsD tags instead of encoding dimensions into metric names
+}
+
+// NewStatsdSink returns a StatsD sink sending metrics to addr.
+// Non-empty prefix is prepended to every metric name.
+func NewStatsdSink(addr, prefix string, tags bool) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &StatsdSink{
+		conn:   conn,
+		prefix: prefix,
+		tags:   tags,
+	}, nil
+}
+
+// Send writes sample counters and gauges as StatsD lines batched into datagrams.
+func (s *StatsdSink) Send(smp *Sample) error {
+	if smp.Kind != sampleKindPoll {
+		return nil
+	}
+
+	var lines []string
+
+	lines = append(lines, s.line("hits", "", "", smp.Tally.Hits, "c"))
+
+	for _, g := range []uint8{2, 3, 4, 5} {
+		class := fmt.Sprintf("%dxx", g)
+		lines = append(lines, s.line("status", "class", class, smp.Tally.StatusCodes[g], "c"))
+	}
+
+	for _, k := range sortedCounts(smp.Tally.Sections) {
+		lines = append(lines, s.line("section.hits", "section", k, smp.Tally.Sections[k], "c"))
+	}
+
+	lines = append(lines, fmt.Sprintf("%savg_traffic:%s|g", s.prefix, formatFloat(smp.AvgTraffic)))
+
+	for _, k := range sortedKeys(smp.States) {
+		lines = append(lines, s.line("alert_state", "rule", k, int(smp.States[k]), "g"))
+	}
+
+	return s.write(lines)
+}
+
+// Close closes the connection.
+func (s *StatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+// line formats one StatsD line. Optional dimension is sent as a DogStatsD tag
+// or, for plain StatsD, is appended to the metric name.
+func (s *StatsdSink) line(name, tag, value string, v int, typ string) string {
+	if tag == "" {
+		return fmt.Sprintf("%s%s:%d|%s", s.prefix, name, v, typ)
+	}
+
+	if s.tags {
+		return fmt.Sprintf("%s%s:%d|%s|#%s:%s", s.prefix, name, v, typ, tag, statsdTagValue(value))
+	}
+
+	return fmt.Sprintf("%s%s.%s:%d|%s", s.prefix, name, namePart(value), v, typ)
+}
+
+// write sends lines packing as many of them into one datagram as possible.
+func (s *StatsdSink) write(lines []string) error {
+	var buf bytes.Buffer
+
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(l) > statsdMaxPacket {
+			if _, err := s.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statsdTagValue removes characters reserved by the DogStatsD line format.
+func statsdTagValue(v string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(v)
+}
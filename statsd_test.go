@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdSink_Send(t *testing.T) {
+
+	tests := []struct {
+		tags     bool
+		expected []string
+	}{
+		{
+			tags: false,
+			expected: []string{
+				"htm.hits:3|c",
+				"htm.status.2xx:2|c",
+				"htm.status.3xx:0|c",
+				"htm.status.4xx:0|c",
+				"htm.status.5xx:1|c",
+				"htm.section.hits.images:1|c",
+				"htm.section.hits.shuttle:2|c",
+				"htm.avg_traffic:4|g",
+				"htm.alert_state.traffic:2|g",
+			},
+		},
+		{
+			tags: true,
+			expected: []string{
+				"htm.hits:3|c",
+				"htm.status:2|c|#class:2xx",
+				"htm.status:0|c|#class:3xx",
+				"htm.status:0|c|#class:4xx",
+				"htm.status:1|c|#class:5xx",
+				"htm.section.hits:1|c|#section:/images",
+				"htm.section.hits:2|c|#section:/shuttle",
+				"htm.avg_traffic:4|g",
+				"htm.alert_state:2|g|#rule:traffic",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Cannot listen: %s", err.Error())
+		}
+
+		sink, err := NewStatsdSink(ln.LocalAddr().String(), "htm", tt.tags)
+		if err != nil {
+			t.Fatalf("NewStatsdSink should not fail. Error: %+v", err)
+		}
+
+		smp := &Sample{
+			AvgTraffic: 4,
+			Kind:       sampleKindPoll,
+			States:     map[string]uint8{ruleTraffic: stateAlert},
+			Tally: &Tally{
+				Hits:        3,
+				Sections:    map[string]int{"/shuttle": 2, "/images": 1},
+				StatusCodes: map[uint8]int{2: 2, 5: 1},
+			},
+		}
+
+		err = sink.Send(smp)
+		if err != nil {
+			t.Fatalf("Send should not fail. Error: %+v", err)
+		}
+
+		buf := make([]byte, statsdMaxPacket)
+		ln.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := ln.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Cannot read datagram: %s", err.Error())
+		}
+
+		actual := strings.Split(string(buf[:n]), "\n")
+
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf("Failed StatsdSink.Send test (tags: %t)!", tt.tags)
+			t.Log("Expected:")
+			t.Logf("%+v\n", tt.expected)
+
+			t.Log("Actual:")
+			t.Logf("%+v\n", actual)
+		}
+
+		sink.Close()
+		ln.Close()
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogName   = "syslog" // source name, also used for messages without a hostname
+	syslogMaxLen = 64 << 10 // longest message accepted, bytes
+)
+
+// errSyslogTooLong closes a TCP connection sending a frame longer than syslogMaxLen.
+var errSyslogTooLong = errors.New("Syslog message is too long.")
+
+// SyslogSource receives log lines as syslog messages over UDP and TCP on the same address.
+// RFC 3164 and RFC 5424 messages are accepted, TCP streams can use octet-counted
+// or newline framing (RFC 6587). Lines are tagged with hostnames of senders.
+type SyslogSource struct {
+	udp   net.PacketConn
+	tcp   net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	lines map[string][]string // message bodies by hostname
+	err   error               // reported once by Read
+}
+
+// NewSyslogSource starts listening on addr.
+func NewSyslogSource(addr string) (*SyslogSource, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same port for TCP, even if addr asks for a random one.
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+
+	src := &SyslogSource{
+		udp:   udp,
+		tcp:   tcp,
+		conns: make(map[net.Conn]bool),
+	}
+
+	go src.serveUDP()
+	go src.serveTCP()
+
+	return src, nil
+}
+
+// Name returns "syslog".
+func (src *SyslogSource) Name() string {
+	return syslogName
+}
+
+// Addr returns the address the source listens on.
+func (src *SyslogSource) Addr() string {
+	return src.udp.LocalAddr().String()
+}
+
+// Read returns message bodies received since the last read, grouped by hostname.
+func (src *SyslogSource) Read() ([]string, error) {
+	hosts, err := src.ReadHosts()
+
+	names := make([]string, 0, len(hosts))
+	for h := range hosts {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, h := range names {
+		out = append(out, hosts[h]...)
+	}
+
+	return out, err
+}
+
+// ReadHosts returns message bodies received since the last read by hostname.
+func (src *SyslogSource) ReadHosts() (map[string][]string, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	lines, err := src.lines, src.err
+	src.lines, src.err = nil, nil
+
+	return lines, err
+}
+
+// Close stops listening and closes client connections.
+func (src *SyslogSource) Close() error {
+	err := src.udp.Close()
+	if terr := src.tcp.Close(); err == nil {
+		err = terr
+	}
+
+	src.mu.Lock()
+	for c := range src.conns {
+		c.Close()
+	}
+	src.mu.Unlock()
+
+	return err
+}
+
+func (src *SyslogSource) serveUDP() {
+	buf := make([]byte, syslogMaxLen)
+
+	for {
+		n, _, err := src.udp.ReadFrom(buf)
+		if err != nil {
+			if !isClosed(err) {
+				src.fail(err)
+			}
+			return
+		}
+
+		// A datagram is one message, some senders still end it with a newline.
+		src.add(strings.TrimRight(string(buf[:n]), "\r\n"))
+	}
+}
+
+func (src *SyslogSource) serveTCP() {
+	for {
+		c, err := src.tcp.Accept()
+		if err != nil {
+			if !isClosed(err) {
+				src.fail(err)
+			}
+			return
+		}
+
+		src.mu.Lock()
+		src.conns[c] = true
+		src.mu.Unlock()
+
+		go func() {
+			src.serveConn(c)
+
+			src.mu.Lock()
+			delete(src.conns, c)
+			src.mu.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// serveConn reads messages from a TCP connection until it is closed.
+// Framing is detected per message: a message starting with a digit is octet-counted.
+func (src *SyslogSource) serveConn(c net.Conn) {
+	r := bufio.NewReader(c)
+
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var m string
+		if b[0] >= '0' && b[0] <= '9' {
+			m, err = readOctetCounted(r)
+		} else {
+			m, err = readLimited(r, '\n', syslogMaxLen)
+		}
+
+		if m = strings.TrimRight(m, "\r\n"); m != "" {
+			src.add(m)
+		}
+
+		if err != nil {
+			if err != io.EOF && !isClosed(err) {
+				src.fail(err)
+			}
+			return
+		}
+	}
+}
+
+// readOctetCounted reads a "LEN SP MSG" frame.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	s, err := readLimited(r, ' ', len(strconv.Itoa(syslogMaxLen))+1)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(s, " "))
+	if err != nil || n <= 0 || n > syslogMaxLen {
+		return "", errors.New("Invalid syslog frame length.")
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// readLimited reads until delim like ReadString, but fails once more than max bytes are buffered,
+// so a client which never sends delim can't make the source allocate without limit.
+func readLimited(r *bufio.Reader, delim byte, max int) (string, error) {
+	var buf []byte
+
+	for {
+		b, err := r.ReadSlice(delim)
+		if len(buf)+len(b) > max {
+			return "", errSyslogTooLong
+		}
+		buf = append(buf, b...)
+
+		if err != bufio.ErrBufferFull {
+			return string(buf), err
+		}
+	}
+}
+
+// add stores a message body, messages which are not syslog are dropped.
+func (src *SyslogSource) add(m string) {
+	host, body, ok := parseSyslog(m)
+	if !ok || strings.TrimSpace(body) == "" {
+		return
+	}
+	if host == "" {
+		host = syslogName
+	}
+
+	src.mu.Lock()
+	if src.lines == nil {
+		src.lines = make(map[string][]string)
+	}
+	src.lines[host] = append(src.lines[host], strings.TrimSpace(body))
+	src.mu.Unlock()
+}
+
+func (src *SyslogSource) fail(err error) {
+	src.mu.Lock()
+	src.err = err
+	src.mu.Unlock()
+}
+
+// parseSyslog returns the hostname and the message body of an RFC 5424 or RFC 3164 message.
+func parseSyslog(m string) (host, body string, ok bool) {
+	// <PRI>
+	if len(m) < 3 || m[0] != '<' {
+		return "", "", false
+	}
+	end := strings.IndexByte(m, '>')
+	if end < 2 || end > 4 {
+		return "", "", false
+	}
+	if _, err := strconv.Atoi(m[1:end]); err != nil {
+		return "", "", false
+	}
+	m = m[end+1:]
+
+	// RFC 5424: VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+	if len(m) > 1 && m[0] >= '1' && m[0] <= '9' && m[1] == ' ' {
+		fields := strings.SplitN(m, " ", 7)
+		if len(fields) < 7 {
+			return "", "", false
+		}
+
+		host = fields[2]
+		if host == "-" {
+			host = ""
+		}
+
+		body, ok = skipStructuredData(fields[6])
+		if !ok {
+			return "", "", false
+		}
+		return host, strings.TrimPrefix(body, "\ufeff"), true
+	}
+
+	// RFC 3164: TIMESTAMP SP HOSTNAME SP TAG: MSG, ex. "Oct 19 10:00:00 web1 nginx: ...".
+	// Without a valid timestamp the whole message is the body.
+	if len(m) < 16 || m[15] != ' ' {
+		return "", m, true
+	}
+	if _, err := time.Parse(time.Stamp, m[:15]); err != nil {
+		return "", m, true
+	}
+	m = m[16:]
+
+	if i := strings.IndexByte(m, ' '); i > 0 {
+		host, m = m[:i], m[i+1:]
+	}
+
+	// TAG, ex. "nginx:" or "nginx[123]:", is at most 32 characters long and has no spaces.
+	if i := strings.Index(m, ": "); i > 0 && i <= 32 && !strings.Contains(m[:i], " ") {
+		m = m[i+2:]
+	}
+
+	return host, m, true
+}
+
+// skipStructuredData strips "-" or "[...]" elements off the beginning of an RFC 5424 message.
+func skipStructuredData(s string) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " "), true
+	}
+
+	for strings.HasPrefix(s, "[") {
+		i := sdElementEnd(s)
+		if i < 0 {
+			return "", false
+		}
+		s = s[i+1:]
+	}
+
+	return strings.TrimPrefix(s, " "), true
+}
+
+// sdElementEnd returns the index of "]" closing a structured data element, -1 if there is none.
+// Parameter values are quoted and can contain escaped characters.
+func sdElementEnd(s string) int {
+	quoted := false
+
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ']' && !quoted:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isClosed tells whether a network error is caused by closing the listener.
+func isClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
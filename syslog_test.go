@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		in   string
+		host string
+		body string
+		ok   bool
+	}{
+		{"<190>Oct 19 10:00:00 web1 nginx: GET / 200", "web1", "GET / 200", true},
+		{"<190>Oct  9 10:00:00 web1 nginx[42]: GET / 200", "web1", "GET / 200", true},
+		{"<13>GET / 200", "", "GET / 200", true},
+		{"<165>1 2026-10-19T10:00:00.003Z web2 nginx 42 - - GET / 200", "web2", "GET / 200", true},
+		{`<165>1 2026-10-19T10:00:00Z - nginx - ID47 [ex@1 a="x\]y"][ex@2 b="z"] GET / 200`, "", "GET / 200", true},
+		{"<165>1 2026-10-19T10:00:00Z web2 nginx - - [ex@1 a=\"x\"", "", "", false},
+		{"GET / 200", "", "", false},
+	}
+
+	for _, test := range tests {
+		host, body, ok := parseSyslog(test.in)
+		if host != test.host || body != test.body || ok != test.ok {
+			t.Errorf("%q: expected %q, %q, %v, got %q, %q, %v", test.in, test.host, test.body, test.ok, host, body, ok)
+		}
+	}
+}
+
+func TestSyslogSource(t *testing.T) {
+	src, err := NewSyslogSource("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	udp, err := net.Dial("udp", src.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<190>Oct 19 10:00:00 web1 nginx: a\n")
+
+	tcp, err := net.Dial("tcp", src.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := "<165>1 2026-10-19T10:00:00Z web2 nginx - - - b"
+	fmt.Fprintf(tcp, "%d %s<190>Oct 19 10:00:00 web2 nginx: c\n", len(m), m)
+	tcp.Close()
+
+	expected := map[string][]string{"web1": {"a"}, "web2": {"b", "c"}}
+	hosts := make(map[string][]string)
+
+	for i := 0; i < 100 && !reflect.DeepEqual(expected, hosts); i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		h, err := src.ReadHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range h {
+			hosts[k] = append(hosts[k], v...)
+		}
+	}
+
+	if !reflect.DeepEqual(expected, hosts) {
+		t.Errorf("Expected %v, got %v", expected, hosts)
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("x", 100)+"\n"), 16)
+
+	if m, err := readLimited(r, '\n', 64); m != "short\n" || err != nil {
+		t.Errorf("Expected short line, got %q, %v", m, err)
+	}
+	if _, err := readLimited(r, '\n', 64); err != errSyslogTooLong {
+		t.Errorf("Expected %v, got %v", errSyslogTooLong, err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// otherKey collects hits of keys above a cardinality limit.
+const otherKey = "other"
+
+// Tally aggregates hit counters of a group of log entries.
+// Memory is proportional to distinct keys, MaxKeys limits them.
+// With Top set sections are counted approximately in memory fixed by its capacity,
+// bytes sent by section are counted by TopBytes the same way.
+type Tally struct {
+	Bytes        int64
+	Hits         int
+	MaxBytes     int64 // largest response
+	MaxKeys      int   // distinct sections and methods kept, the rest is counted as otherKey, 0 - no limit
+	Methods      map[string]int
+	SectionBytes map[string]int64 // bytes sent by section, keys follow Sections unless TopBytes is set
+	Sections     map[string]int
+	StatusCodes  map[uint8]int // status code groups: 2xx, 3xx, 4xx, 5xx
+	Top          *TopK         // heavy hitters mode, Sections holds only keys monitored by Top, nil - exact counts
+	TopBytes     *TopK         // heavy hitters mode, SectionBytes holds only keys monitored by TopBytes
+
+	Visitors        *HLL            // distinct visitors, nil unless counted
+	SectionVisitors map[string]*HLL // distinct visitors by section, nil unless counted
+
+	Latency        *Quantiles            // request durations, created on first entry with one
+	SectionLatency map[string]*Quantiles // request durations by section, nil unless counted
+}
+
+// NewTally returns an empty Tally.
+func NewTally() *Tally {
+	return &Tally{
+		Methods:      make(map[string]int),
+		SectionBytes: make(map[string]int64),
+		Sections:     make(map[string]int),
+		StatusCodes:  make(map[uint8]int),
+	}
+}
+
+// AvgBytes returns an average response size.
+func (t *Tally) AvgBytes() float64 {
+	if t.Hits == 0 {
+		return 0
+	}
+	return float64(t.Bytes) / float64(t.Hits)
+}
+
+// CountSectionLatency enables latency quantiles by section.
+func (t *Tally) CountSectionLatency() {
+	t.SectionLatency = make(map[string]*Quantiles)
+}
+
+// CountVisitors enables counting of distinct visitors, in total and by section.
+func (t *Tally) CountVisitors() {
+	t.Visitors = NewHLL(hllPrecision)
+	t.SectionVisitors = make(map[string]*HLL)
+}
+
+// Add registers an entry in the tally.
+func (t *Tally) Add(e *Entry) {
+	t.Hits++
+	t.Bytes += e.BytesSent
+	if e.BytesSent > t.MaxBytes {
+		t.MaxBytes = e.BytesSent
+	}
+	t.Methods[t.key(t.Methods, e.Method)]++
+	section := t.addSection(e.Section, 1)
+	t.addSectionBytes(section, e.BytesSent)
+
+	if g, err := statusGroup(e.StatusCode); err == nil {
+		t.StatusCodes[g]++
+	}
+
+	if e.HasLatency {
+		if t.Latency == nil {
+			t.Latency = NewQuantiles()
+		}
+		t.Latency.Add(e.Latency)
+		if t.SectionLatency != nil {
+			t.sectionLatency(section).Add(e.Latency)
+		}
+	}
+
+	if t.Visitors != nil && e.Visitor != "" {
+		t.Visitors.Add(e.Visitor)
+		if t.SectionVisitors != nil {
+			t.sectionVisitors(section).Add(e.Visitor)
+		}
+	}
+}
+
+// Merge adds counters of another tally.
+// In heavy hitters mode error bounds of the other tally's sketches are added to the merged counts.
+func (t *Tally) Merge(o *Tally) {
+	t.Hits += o.Hits
+	t.Bytes += o.Bytes
+	if o.MaxBytes > t.MaxBytes {
+		t.MaxBytes = o.MaxBytes
+	}
+
+	for k, v := range o.Methods {
+		t.Methods[t.key(t.Methods, k)] += v
+	}
+	for k, v := range o.Sections {
+		section := t.addSection(k, v)
+		if t.Top != nil && o.Top != nil {
+			t.Top.AddErr(section, o.Top.Err(k))
+		}
+		if t.TopBytes == nil {
+			t.SectionBytes[section] += o.SectionBytes[k]
+		}
+		if t.SectionVisitors != nil && o.SectionVisitors[k] != nil {
+			t.sectionVisitors(section).Merge(o.SectionVisitors[k])
+		}
+		if t.SectionLatency != nil && o.SectionLatency[k] != nil {
+			t.sectionLatency(section).Merge(o.SectionLatency[k])
+		}
+	}
+	if t.TopBytes != nil {
+		for k, v := range o.SectionBytes {
+			t.addSectionBytes(k, v)
+			if o.TopBytes != nil {
+				t.TopBytes.AddErr(k, o.TopBytes.Err(k))
+			}
+		}
+	}
+	if o.Latency != nil {
+		if t.Latency == nil {
+			t.Latency = NewQuantiles()
+		}
+		t.Latency.Merge(o.Latency)
+	}
+	if t.Visitors != nil {
+		t.Visitors.Merge(o.Visitors)
+	}
+	for k, v := range o.StatusCodes {
+		t.StatusCodes[k] += v
+	}
+}
+
+// addSection counts n hits of a section and returns the key they are counted under.
+func (t *Tally) addSection(k string, n int) string {
+	if t.Top == nil {
+		k = t.key(t.Sections, k)
+		t.Sections[k] += n
+		return k
+	}
+
+	if evicted, ok := t.Top.Add(k, n); ok {
+		delete(t.Sections, evicted)
+		delete(t.SectionVisitors, evicted)
+		delete(t.SectionLatency, evicted)
+	}
+	t.Sections[k] = t.Top.Count(k)
+	return k
+}
+
+// addSectionBytes counts n bytes sent by a section, k is a key returned by addSection.
+func (t *Tally) addSectionBytes(k string, n int64) {
+	if t.TopBytes == nil {
+		t.SectionBytes[k] += n
+		return
+	}
+
+	// Empty responses would only evict keys.
+	if n <= 0 {
+		return
+	}
+	if evicted, ok := t.TopBytes.Add(k, int(n)); ok {
+		delete(t.SectionBytes, evicted)
+	}
+	t.SectionBytes[k] = int64(t.TopBytes.Count(k))
+}
+
+// sectionLatency returns the latency sketch of a section, creating it if needed.
+func (t *Tally) sectionLatency(k string) *Quantiles {
+	q := t.SectionLatency[k]
+	if q == nil {
+		q = NewQuantiles()
+		t.SectionLatency[k] = q
+	}
+	return q
+}
+
+// sectionVisitors returns the distinct visitors sketch of a section, creating it if needed.
+func (t *Tally) sectionVisitors(k string) *HLL {
+	h := t.SectionVisitors[k]
+	if h == nil {
+		h = NewHLL(hllSectionPrecision)
+		t.SectionVisitors[k] = h
+	}
+	return h
+}
+
+// key returns k, or otherKey if k is new to m and m is at the limit.
+func (t *Tally) key(m map[string]int, k string) string {
+	_, ok := m[k]
+	return cappedKey(k, ok, len(m), t.MaxKeys)
+}
+
+// cappedKey returns k if it is known or there is room for it among keys, otherKey otherwise.
+func cappedKey(k string, known bool, keys, max int) string {
+	if known || max <= 0 || keys < max {
+		return k
+	}
+	return otherKey
+}
+
+// statusGroup returns a status code group, ex. 4 for 404.
+func statusGroup(code string) (uint8, error) {
+	if code == "" {
+		return 0, errors.New("Empty status code")
+	}
+
+	i, err := strconv.Atoi(code[0:1])
+	if err != nil {
+		return 0, err
+	}
+
+	return uint8(i), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTally_Add(t *testing.T) {
+
+	tl := NewTally()
+	tl.Add(&Entry{Method: "GET", Section: "/shuttle", StatusCode: "200", BytesSent: 100})
+	tl.Add(&Entry{Method: "POST", Section: "/shuttle", StatusCode: "503", BytesSent: 20})
+	tl.Add(&Entry{Method: "GET", Section: "/images", StatusCode: "", BytesSent: 0})
+
+	expected := &Tally{
+		Bytes:        120,
+		Hits:         3,
+		MaxBytes:     100,
+		Methods:      map[string]int{"GET": 2, "POST": 1},
+		SectionBytes: map[string]int64{"/shuttle": 120, "/images": 0},
+		Sections:     map[string]int{"/shuttle": 2, "/images": 1},
+		StatusCodes:  map[uint8]int{2: 1, 5: 1},
+	}
+
+	if !reflect.DeepEqual(expected, tl) {
+		t.Error("Failed Tally.Add test!")
+		t.Log("Expected:")
+		t.Logf("%+v\n", expected)
+
+		t.Log("Actual:")
+		t.Logf("%+v\n", tl)
+	}
+}
+
+func TestTally_MaxKeys(t *testing.T) {
+	tl := NewTally()
+	tl.MaxKeys = 2
+	tl.Add(&Entry{Method: "GET", Section: "/shuttle", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/images", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/history", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/shuttle", StatusCode: "200"})
+
+	o := NewTally()
+	o.Add(&Entry{Method: "GET", Section: "/facts", StatusCode: "200"})
+	o.Add(&Entry{Method: "GET", Section: "/images", StatusCode: "200"})
+	tl.Merge(o)
+
+	// Known keys keep counting, new ones above the limit go to the other bucket.
+	expected := map[string]int{"/shuttle": 2, "/images": 2, otherKey: 2}
+	if !reflect.DeepEqual(expected, tl.Sections) || tl.Hits != 6 {
+		t.Errorf("Expected sections %v of %d hits, got %v of %d", expected, 6, tl.Sections, tl.Hits)
+	}
+}
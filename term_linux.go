@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// termState keeps terminal settings to restore after raw mode.
+type termState struct {
+	fd   uintptr
+	orig syscall.Termios
+}
+
+// makeRaw switches terminal to a non-canonical, no-echo mode, so single key presses are read immediately.
+func makeRaw(f *os.File) (*termState, error) {
+	st := &termState{fd: f.Fd()}
+
+	if err := ioctlTermios(st.fd, syscall.TCGETS, &st.orig); err != nil {
+		return nil, err
+	}
+
+	raw := st.orig
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctlTermios(st.fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// restore returns terminal to its original settings.
+func (st *termState) restore() error {
+	return ioctlTermios(st.fd, syscall.TCSETS, &st.orig)
+}
+
+// termSize returns terminal width and height.
+func termSize(f *os.File) (int, int, error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+
+	return int(ws.Col), int(ws.Row), nil
+}
+
+func ioctlTermios(fd, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
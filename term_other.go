@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// termState is a no-op on platforms without raw mode support, keys are read after Enter.
+type termState struct{}
+
+func makeRaw(f *os.File) (*termState, error) {
+	return &termState{}, nil
+}
+
+func (st *termState) restore() error {
+	return nil
+}
+
+func termSize(f *os.File) (int, int, error) {
+	return 0, 0, errors.New("Terminal size is not available")
+}
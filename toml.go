@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// tomlTable is a parsed TOML table. Values are string, int64, float64, bool,
+// []interface{} for arrays, tomlTable for sub-tables and []tomlTable for arrays of tables.
+type tomlTable map[string]interface{}
+
+// parseTOML reads a TOML document. It supports the subset used by configuration files:
+// comments, bare and quoted keys, [tables], [[arrays of tables]], basic and literal strings,
+// integers, floats, booleans and single-line arrays.
+func parseTOML(r io.Reader) (tomlTable, error) {
+	root := tomlTable{}
+	cur := root
+	defined := make(map[string]bool) // [table] headers seen, by normalized name
+
+	sc := bufio.NewScanner(r)
+	n := 0
+
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(line, "[["):
+			if !strings.HasSuffix(line, "]]") {
+				return nil, fmt.Errorf("line %d: invalid array of tables header", n)
+			}
+			name := tomlTableName(line[2 : len(line)-2])
+			cur, err = tomlArrayTable(root, name)
+
+			// Sub-tables belong to the new element now, they can be defined again.
+			for k := range defined {
+				if strings.HasPrefix(k, name+".") {
+					delete(defined, k)
+				}
+			}
+
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header", n)
+			}
+			name := tomlTableName(line[1 : len(line)-1])
+			if defined[name] {
+				return nil, fmt.Errorf("line %d: duplicate table [%s]", n, name)
+			}
+			defined[name] = true
+			cur, err = tomlSubTable(root, name)
+
+		default:
+			err = tomlKeyValue(cur, line)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// tomlTableName normalizes a dotted table name of a header, ex. ` a . "b" ` -> "a.b".
+func tomlTableName(name string) string {
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	for i, part := range parts {
+		parts[i] = unquoteKey(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+// tomlSubTable returns a table by its dotted name creating it if required.
+func tomlSubTable(root tomlTable, name string) (tomlTable, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty table name")
+	}
+
+	t := root
+	for _, part := range strings.Split(name, ".") {
+		part = unquoteKey(strings.TrimSpace(part))
+
+		switch v := t[part].(type) {
+		case nil:
+			sub := tomlTable{}
+			t[part] = sub
+			t = sub
+		case tomlTable:
+			t = v
+		case []tomlTable:
+			t = v[len(v)-1]
+		default:
+			return nil, fmt.Errorf("key %s is already defined as a value", part)
+		}
+	}
+
+	return t, nil
+}
+
+// tomlArrayTable appends a new table to an array of tables.
+func tomlArrayTable(root tomlTable, name string) (tomlTable, error) {
+	parent := root
+	parts := strings.Split(name, ".")
+
+	if len(parts) > 1 {
+		var err error
+		parent, err = tomlSubTable(root, strings.Join(parts[:len(parts)-1], "."))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := unquoteKey(strings.TrimSpace(parts[len(parts)-1]))
+	if key == "" {
+		return nil, fmt.Errorf("empty table name")
+	}
+
+	t := tomlTable{}
+
+	switch v := parent[key].(type) {
+	case nil:
+		parent[key] = []tomlTable{t}
+	case []tomlTable:
+		parent[key] = append(v, t)
+	default:
+		return nil, fmt.Errorf("key %s is already defined", key)
+	}
+
+	return t, nil
+}
+
+// tomlKeyValue parses a key = value line into t.
+func tomlKeyValue(t tomlTable, line string) error {
+	// Quoted keys can contain "=".
+	i := indexUnquoted(line, '=')
+	if i < 0 {
+		return fmt.Errorf("expected key = value")
+	}
+
+	key := unquoteKey(strings.TrimSpace(line[:i]))
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	if _, ok := t[key]; ok {
+		return fmt.Errorf("duplicate key %s", key)
+	}
+
+	v, rest, err := tomlValue(strings.TrimSpace(line[i+1:]))
+	if err != nil {
+		return fmt.Errorf("key %s: %s", key, err.Error())
+	}
+
+	if strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("key %s: unexpected %q after value", key, rest)
+	}
+
+	t[key] = v
+
+	return nil
+}
+
+// tomlValue parses a value at the beginning of s returning the remainder.
+func tomlValue(s string) (interface{}, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+
+	case s[0] == '"':
+		return tomlBasicString(s)
+
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+
+	case s[0] == '[':
+		return tomlArray(s)
+	}
+
+	// Bare value runs until a delimiter.
+	end := strings.IndexAny(s, ",]")
+	if end < 0 {
+		end = len(s)
+	}
+	raw := strings.TrimSpace(s[:end])
+	rest := s[end:]
+
+	switch raw {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+
+	clean := strings.Replace(raw, "_", "", -1)
+
+	if i, err := strconv.ParseInt(clean, 10, 64); err == nil {
+		return i, rest, nil
+	}
+
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, rest, nil
+	}
+
+	return nil, "", fmt.Errorf("invalid value %q", raw)
+}
+
+// tomlBasicString parses a double-quoted string with escapes.
+func tomlBasicString(s string) (interface{}, string, error) {
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		case '"':
+			return b.String(), s[i+1:], nil
+
+		case '\\':
+			i++
+			if i >= len(s) {
+				return nil, "", fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				return nil, "", fmt.Errorf("unsupported escape \\%c", s[i])
+			}
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return nil, "", fmt.Errorf("unterminated string")
+}
+
+// tomlArray parses a single-line array.
+func tomlArray(s string) (interface{}, string, error) {
+	out := []interface{}{}
+	s = strings.TrimSpace(s[1:])
+
+	for {
+		if strings.HasPrefix(s, "]") {
+			return out, s[1:], nil
+		}
+
+		v, rest, err := tomlValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		out = append(out, v)
+
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated array")
+		}
+	}
+}
+
+// stripComment removes a # comment which is not inside a string.
+func stripComment(s string) string {
+	if i := indexUnquoted(s, '#'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// indexUnquoted returns the index of the first c which is not inside a string, -1 if there is none.
+func indexUnquoted(s string, c byte) int {
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unquoteKey(k string) string {
+	if len(k) >= 2 && (k[0] == '"' && k[len(k)-1] == '"' || k[0] == '\'' && k[len(k)-1] == '\'') {
+		return k[1 : len(k)-1]
+	}
+	return k
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc := `
+title = "monitor" # trailing comment
+count = 1_000
+ratio = 0.5
+on = true
+tags = ["a", 'b#c', 2]
+
+[statsd]
+"addr" = "127.0.0.1:8125"
+"a=b" = 1
+
+[[rules]]
+name = "first"
+[rules.labels]
+team = "web"
+
+[[rules]]
+name = "second"
+[rules.labels]
+team = "api"
+`
+
+	actual, err := parseTOML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("parseTOML should not fail. Error: %+v", err)
+	}
+
+	expected := tomlTable{
+		"title":  "monitor",
+		"count":  int64(1000),
+		"ratio":  0.5,
+		"on":     true,
+		"tags":   []interface{}{"a", "b#c", int64(2)},
+		"statsd": tomlTable{"addr": "127.0.0.1:8125", "a=b": int64(1)},
+		"rules": []tomlTable{
+			{"name": "first", "labels": tomlTable{"team": "web"}},
+			{"name": "second", "labels": tomlTable{"team": "api"}},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Error("Failed parseTOML test!")
+		t.Logf("Expected: %+v", expected)
+		t.Logf("Actual: %+v", actual)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	docs := []string{
+		"key",
+		"key = ",
+		"key = \"open",
+		"key = 1\nkey = 2",
+		"[table",
+		"key = [1, 2",
+		"key = nope",
+		"[table]\na = 1\n[table]\nb = 2",
+		"[a.b]\n[ a . \"b\" ]",
+	}
+
+	for _, d := range docs {
+		if _, err := parseTOML(strings.NewReader(d)); err == nil {
+			t.Errorf("Expected an error parsing %q", d)
+		}
+	}
+}
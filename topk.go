@@ -0,0 +1,114 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// TopK finds the most frequent keys in fixed memory with the Space-Saving algorithm.
+// It monitors at most Capacity keys, a new key replaces the least counted one and inherits its count,
+// so counts of the top keys are overestimated by at most Err, which is below total hits / Capacity.
+// Counters are allocated as keys arrive, an idle TopK takes no memory for them.
+type TopK struct {
+	Capacity int
+
+	keys map[string]*topKCounter
+	heap topKHeap // min-heap by count, the first counter is evicted next
+}
+
+type topKCounter struct {
+	key   string
+	count int
+	err   int // maximum overestimation of count
+	index int // position in heap
+}
+
+// NewTopK returns an empty TopK monitoring capacity keys, at least one.
+func NewTopK(capacity int) *TopK {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &TopK{
+		Capacity: capacity,
+		keys:     make(map[string]*topKCounter),
+	}
+}
+
+// Add counts n hits of key in O(log Capacity).
+// If key replaced another one, the evicted key is returned.
+func (t *TopK) Add(key string, n int) (evicted string, ok bool) {
+	if c, found := t.keys[key]; found {
+		c.count += n
+		heap.Fix(&t.heap, c.index)
+		return "", false
+	}
+
+	if len(t.heap) < t.Capacity {
+		c := &topKCounter{key: key, count: n}
+		t.keys[key] = c
+		heap.Push(&t.heap, c)
+		return "", false
+	}
+
+	// Reuse the least counted counter, its count is the most the new key could have had before.
+	c := t.heap[0]
+	delete(t.keys, c.key)
+	evicted = c.key
+
+	c.key = key
+	c.err = c.count
+	c.count += n
+	t.keys[key] = c
+	heap.Fix(&t.heap, 0)
+
+	return evicted, true
+}
+
+// Count returns an estimated count of key, 0 if key is not monitored.
+func (t *TopK) Count(key string) int {
+	if c, ok := t.keys[key]; ok {
+		return c.count
+	}
+	return 0
+}
+
+// Err returns the maximum overestimation of the count of key.
+func (t *TopK) Err(key string) int {
+	if c, ok := t.keys[key]; ok {
+		return c.err
+	}
+	return 0
+}
+
+// AddErr raises the maximum overestimation of a monitored key by err,
+// ex. by the error bound of a count merged from another sketch.
+func (t *TopK) AddErr(key string, err int) {
+	if c, ok := t.keys[key]; ok {
+		c.err += err
+	}
+}
+
+// topKHeap implements heap.Interface over counters.
+type topKHeap []*topKCounter
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	c := x.(*topKCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTopK_Add(t *testing.T) {
+	k := NewTopK(2)
+	k.Add("/shuttle", 3)
+	k.Add("/images", 1)
+
+	// The least counted key is replaced, its count is the error bound of the new one.
+	evicted, ok := k.Add("/history", 1)
+	if !ok || evicted != "/images" {
+		t.Errorf("Expected /images to be evicted, got %q, %v", evicted, ok)
+	}
+
+	if k.Count("/history") != 2 || k.Err("/history") != 1 || k.Count("/images") != 0 {
+		t.Errorf("Unexpected counters: /history %d ±%d, /images %d", k.Count("/history"), k.Err("/history"), k.Count("/images"))
+	}
+}
+
+func TestTopK_Scan(t *testing.T) {
+	k := NewTopK(100) // keys above 1% of hits are always found
+	exact := map[string]int{}
+	total := 0
+
+	// Heavy hitters hidden in a scan of unique paths.
+	for i := 0; i < 100000; i++ {
+		key := "/scan/" + strconv.Itoa(i)
+		switch {
+		case i%10 == 0:
+			key = "/shuttle"
+		case i%25 == 1:
+			key = "/images"
+		case i%50 == 2:
+			key = "/history"
+		}
+		k.Add(key, 1)
+		exact[key]++
+		total++
+	}
+
+	for _, key := range []string{"/shuttle", "/images", "/history"} {
+		c, e := k.Count(key), k.Err(key)
+		if c < exact[key] || c-e > exact[key] {
+			t.Errorf("%s: expected %d within %d ±%d", key, exact[key], c, e)
+		}
+		if e > total/k.Capacity {
+			t.Errorf("%s: error %d above the bound of %d", key, e, total/k.Capacity)
+		}
+	}
+
+	hl := CutTopN(RankByHits(map[string]int{
+		"/shuttle": k.Count("/shuttle"),
+		"/images":  k.Count("/images"),
+		"/history": k.Count("/history"),
+	}), 3)
+	if hl[0].Key != "/shuttle" || hl[1].Key != "/images" || hl[2].Key != "/history" {
+		t.Errorf("Unexpected top sections %v", hl)
+	}
+}
+
+func TestTally_Top(t *testing.T) {
+	tl := NewTally()
+	tl.Top = NewTopK(2)
+	tl.Add(&Entry{Method: "GET", Section: "/shuttle", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/shuttle", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/images", StatusCode: "200"})
+	tl.Add(&Entry{Method: "GET", Section: "/history", StatusCode: "200"})
+
+	// Sections follow the keys monitored by the sketch.
+	expected := map[string]int{"/shuttle": 2, "/history": 2}
+	if !reflect.DeepEqual(expected, tl.Sections) {
+		t.Errorf("Expected sections %v, got %v", expected, tl.Sections)
+	}
+}
+
+func TestTally_TopBytes(t *testing.T) {
+	tl := NewTally()
+	tl.Top = NewTopK(2)
+	tl.TopBytes = NewTopK(2)
+	tl.Add(&Entry{Section: "/images", StatusCode: "200", BytesSent: 5000})
+	tl.Add(&Entry{Section: "/shuttle", StatusCode: "200", BytesSent: 10})
+	tl.Add(&Entry{Section: "/shuttle", StatusCode: "200", BytesSent: 10})
+	tl.Add(&Entry{Section: "/history", StatusCode: "200", BytesSent: 100})
+
+	// Bytes are counted apart from hits, the heaviest section is kept after it drops out of sections by hits.
+	expected := map[string]int64{"/images": 5000, "/history": 120}
+	if !reflect.DeepEqual(expected, tl.SectionBytes) {
+		t.Errorf("Expected section bytes %v, got %v", expected, tl.SectionBytes)
+	}
+	if err := tl.TopBytes.Err("/history"); err != 20 {
+		t.Errorf("Expected error bound %d, got %d", 20, err)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// UI modes.
+
+	uiConsole = "console"
+	uiTUI     = "tui"
+
+	tuiDefWidth  = 80
+	tuiDefHeight = 24
+
+	// ANSI escape sequences.
+
+	ansiAltScreenOn  = "\x1b[?1049h\x1b[?25l" // switch to alternate screen, hide cursor
+	ansiAltScreenOff = "\x1b[?25h\x1b[?1049l" // show cursor, back to main screen
+	ansiHome         = "\x1b[H"
+	ansiClearLine    = "\x1b[K"
+	ansiClearBelow   = "\x1b[J"
+	ansiGreen        = "\x1b[32m"
+	ansiRed          = "\x1b[31m"
+	ansiReverse      = "\x1b[7m"
+	ansiYellow       = "\x1b[33m"
+	ansiReset        = "\x1b[0m"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard is a full-screen terminal UI, an alternative to Printer.
+// Instead of streaming messages it keeps the latest state and redraws a fixed screen.
+type Dashboard struct {
+	cfg  *Config
+	in   *os.File
+	out  io.Writer
+	term *termState
+
+	// User controls.
+	paused     bool
+	scroll     int // alert history lines scrolled back
+	sortByName bool
+	topN       uint
+
+	// Latest state.
+	alert     bool
+	alerts    []msg
+	lastErr   string
+	points    []int
+	rates     []WindowRate
+	report    *Report
+	summary   string // open alerts on shutdown, printed after the screen is restored
+	threshold float64
+	traffic   float64
+}
+
+// NewDashboard returns a Dashboard drawing to stdout and reading keys from stdin.
+func NewDashboard(cfg *Config) *Dashboard {
+	return &Dashboard{
+		cfg:       cfg,
+		in:        os.Stdin,
+		out:       os.Stdout,
+		threshold: cfg.AlertThreshold,
+		topN:      cfg.TopN,
+	}
+}
+
+// Start switches terminal to the alternate screen and key-by-key input mode.
+func (d *Dashboard) Start() error {
+	st, err := makeRaw(d.in)
+	if err != nil {
+		return fmt.Errorf("Cannot set up terminal: %s", err.Error())
+	}
+	d.term = st
+
+	fmt.Fprint(d.out, ansiAltScreenOn)
+
+	return nil
+}
+
+// Stop restores terminal to its original state.
+func (d *Dashboard) Stop() {
+	fmt.Fprint(d.out, ansiAltScreenOff)
+
+	if d.term != nil {
+		d.term.restore()
+	}
+
+	if d.summary != "" {
+		fmt.Fprintln(d.out, d.summary)
+	}
+}
+
+// Run redraws the screen on every message or key press until msgChan is closed.
+// Quitting calls stop and waits for the monitor to shut down.
+func (d *Dashboard) Run(stop func(), msgChan <-chan msg) {
+	keys := make(chan byte)
+	go readKeys(d.in, keys)
+
+	d.render()
+
+	for {
+		select {
+		case m, ok := <-msgChan:
+			if !ok {
+				return
+			}
+			d.update(m)
+			if d.paused {
+				continue
+			}
+
+		case k := <-keys:
+			if !d.key(k) {
+				stop()
+			}
+		}
+
+		d.render()
+	}
+}
+
+// update applies a monitor message to the dashboard state.
+func (d *Dashboard) update(m msg) {
+	switch m.msgType {
+	case msgTypeError:
+		d.lastErr = m.body
+	case msgTypeAlertEsc, msgTypeAlertDeesc:
+		// Header state follows the built-in traffic rule, other rules are listed in the history.
+		if m.rule == "" {
+			d.alert = m.msgType == msgTypeAlertEsc
+		}
+		d.alerts = append(d.alerts, m)
+	case msgTypePoint:
+		d.traffic = m.traffic
+		d.threshold = m.threshold
+		d.points = m.points
+		d.rates = m.rates
+	case msgTypeReport:
+		d.report = m.report
+	case msgTypeOpenAlerts:
+		d.summary = m.body
+	case msgTypeReload:
+		d.cfg = m.config
+		d.threshold = m.config.AlertThreshold
+		d.topN = m.config.TopN
+	}
+}
+
+// key handles a key press, returns false if user asked to quit.
+func (d *Dashboard) key(k byte) bool {
+	switch k {
+	case 'q', 'Q':
+		return false
+	case 'p', 'P', ' ':
+		d.paused = !d.paused
+	case '+', '=':
+		d.topN++
+	case '-', '_':
+		if d.topN > 1 {
+			d.topN--
+		}
+	case 's', 'S':
+		d.sortByName = !d.sortByName
+	case 'k', 'K':
+		if d.scroll < len(d.alerts)-1 {
+			d.scroll++
+		}
+	case 'j', 'J':
+		if d.scroll > 0 {
+			d.scroll--
+		}
+	}
+
+	return true
+}
+
+// render redraws the whole screen.
+func (d *Dashboard) render() {
+	w, h, err := termSize(d.in)
+	if err != nil || w <= 0 || h <= 0 {
+		w, h = tuiDefWidth, tuiDefHeight
+	}
+
+	var b strings.Builder
+	b.WriteString(ansiHome)
+	for i, l := range d.lines(w, h) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(l)
+		b.WriteString(ansiClearLine)
+	}
+	b.WriteString(ansiClearBelow)
+
+	io.WriteString(d.out, b.String())
+}
+
+// lines builds screen content for a terminal of w x h characters.
+func (d *Dashboard) lines(w, h int) []string {
+	var top []string
+
+	// Header.
+	state := colorize("OK", ansiGreen)
+	if d.alert {
+		state = colorize("ALERT", ansiRed)
+	}
+	header := fmt.Sprintf(" HTTP traffic monitor · %s · hits avg %s / %s · ", strings.Join(d.cfg.Files, ", "), formatValue(d.traffic), formatValue(d.threshold))
+	if len(d.rates) > 0 {
+		header += ratesText(d.rates) + " · "
+	}
+	header = truncate(header, w-12) + state
+	if d.paused {
+		header += " " + colorize("PAUSED", ansiReverse)
+	}
+	top = append(top, header, "")
+
+	// Traffic sparkline.
+	top = append(top, truncate(fmt.Sprintf(" Hits per poll, last %d polls", len(d.points)), w))
+	top = append(top, " "+sparkline(d.points, d.threshold*d.cfg.PollInt.Seconds(), w-2), "")
+
+	// Top sections.
+	top = append(top, d.sectionLines(w)...)
+	top = append(top, "")
+
+	// Status codes.
+	top = append(top, d.statusLines(w)...)
+	top = append(top, "")
+
+	footer := []string{
+		truncate(" p pause · +/- top-N · s sort · j/k scroll alerts · q quit", w),
+	}
+	if d.lastErr != "" {
+		footer = append([]string{colorize(truncate(" "+strings.TrimSpace(d.lastErr), w), ansiYellow)}, footer...)
+	}
+
+	// Alert history takes all remaining rows.
+	rows := h - len(top) - len(footer)
+	return append(append(top, d.alertLines(w, rows)...), footer...)
+}
+
+// sectionLines renders the top sections table of the last report.
+func (d *Dashboard) sectionLines(w int) []string {
+	order := "hits"
+	if d.sortByName {
+		order = "name"
+	}
+
+	out := []string{fmt.Sprintf(" Top %d sections, by %s", d.topN, order)}
+
+	if d.report == nil || d.report.Tally == nil || len(d.report.Tally.Sections) == 0 {
+		return append(out, " no entries")
+	}
+
+	var hl HitList
+	if d.sortByName {
+		hl = HitList{}
+		for i, k := range sortedCounts(d.report.Tally.Sections) {
+			hl[i] = Pair{k, d.report.Tally.Sections[k]}
+		}
+	} else {
+		hl = RankByHits(d.report.Tally.Sections)
+	}
+	hl = CutTopN(hl, d.topN)
+
+	nameW := w - 16
+	if nameW < 10 {
+		nameW = 10
+	}
+	for i := 0; i < len(hl); i++ {
+		err := 0
+		if d.report.Tally.Top != nil {
+			err = d.report.Tally.Top.Err(hl[i].Key)
+		}
+		out = append(out, " "+rightPad2Len(truncate(hl[i].Key, nameW), " ", nameW)+" "+countText(hl[i].Value, err))
+	}
+
+	return out
+}
+
+// statusLines renders status code groups of the last report as horizontal bars.
+func (d *Dashboard) statusLines(w int) []string {
+	out := []string{" Status codes"}
+
+	if d.report == nil {
+		return append(out, " no entries")
+	}
+	if d.report.SectionVisitors != nil {
+		out[0] = fmt.Sprintf(" Status codes · %d visitors", d.report.Visitors)
+	}
+
+	max := 0
+	for _, v := range d.report.StatusCodes {
+		if v > max {
+			max = v
+		}
+	}
+
+	barW := w - 16
+	for _, g := range []uint8{2, 3, 4, 5} {
+		v := d.report.StatusCodes[g]
+		n := 0
+		if max > 0 && barW > 0 {
+			n = v * barW / max
+		}
+
+		color := ansiGreen
+		switch g {
+		case 4:
+			color = ansiYellow
+		case 5:
+			color = ansiRed
+		}
+
+		out = append(out, fmt.Sprintf(" %dxx %s %d", g, colorize(strings.Repeat("█", n), color), v))
+	}
+
+	if st := d.report.Latency; st != nil {
+		out = append(out, truncate(fmt.Sprintf(" Latency p50 %s · p90 %s · p99 %s · max %s", formatLatency(st.P50), formatLatency(st.P90), formatLatency(st.P99), formatLatency(st.Max)), w))
+	}
+
+	if t := d.report.Tally; t != nil && t.Bytes > 0 {
+		out = append(out, truncate(fmt.Sprintf(" Bandwidth %s · avg %s · max %s", formatBytes(float64(t.Bytes)), formatBytes(t.AvgBytes()), formatBytes(float64(t.MaxBytes))), w))
+	}
+
+	return out
+}
+
+// alertLines renders the alert history, most recent at the bottom, within given rows.
+func (d *Dashboard) alertLines(w, rows int) []string {
+	if rows < 2 {
+		return nil
+	}
+
+	out := []string{fmt.Sprintf(" Alert history (%d)", len(d.alerts))}
+	rows--
+
+	end := len(d.alerts) - d.scroll
+	start := end - rows
+	if start < 0 {
+		start = 0
+	}
+
+	for _, m := range d.alerts[start:end] {
+		s := fmt.Sprintf(" %s · %s", m.time.Format(reportTimeFormat), alertText(m))
+		color := ansiGreen
+		if m.msgType == msgTypeAlertEsc {
+			color = ansiRed
+		}
+		out = append(out, colorize(truncate(s, w), color))
+	}
+
+	for len(out) <= rows {
+		out = append(out, "")
+	}
+
+	return out
+}
+
+// sparkline renders the last width points as block characters scaled to the max of points and threshold,
+// the threshold is in hits per point.
+func sparkline(points []int, threshold float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(points) > width {
+		points = points[len(points)-width:]
+	}
+
+	max := int(math.Ceil(threshold))
+	for _, p := range points {
+		if p > max {
+			max = p
+		}
+	}
+	if max <= 0 {
+		max = 1
+	}
+
+	out := make([]rune, len(points))
+	for i, p := range points {
+		if p < 0 {
+			p = 0
+		}
+		out[i] = sparkBlocks[p*(len(sparkBlocks)-1)/max]
+	}
+
+	return string(out)
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func colorize(s, color string) string {
+	return color + s + ansiReset
+}
+
+// readKeys passes key presses to keys until input is closed.
+func readKeys(in io.Reader, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		if n == 1 {
+			keys <- buf[0]
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	expected := "▁▄█"
+	actual := sparkline([]int{9, 0, 1, 2}, 2, 3) // the oldest point doesn't fit
+
+	if expected != actual {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestDashboard_key(t *testing.T) {
+	d := NewDashboard(&Config{TopN: 1})
+	d.alerts = make([]msg, 3)
+
+	for _, k := range "p+-+s-kkk" {
+		if !d.key(byte(k)) {
+			t.Fatalf("Key %c should not quit", k)
+		}
+	}
+
+	if !d.paused || d.topN != 1 || !d.sortByName || d.scroll != 2 {
+		t.Errorf("Unexpected state: paused %t, topN %d, sortByName %t, scroll %d", d.paused, d.topN, d.sortByName, d.scroll)
+	}
+
+	if d.key('q') {
+		t.Error("Key q should quit")
+	}
+}
+
+func TestDashboard_lines(t *testing.T) {
+	d := NewDashboard(&Config{Files: []string{"server.log"}, TopN: 2, AlertThreshold: 2})
+
+	rep := NewReport(nil)
+	rep.Tally = &Tally{Sections: map[string]int{"/shuttle": 3, "/images": 5, "/history": 1}}
+	rep.StatusCodes[2] = 6
+	rep.StatusCodes[5] = 3
+
+	at := time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)
+
+	d.update(msgPoint(3, 2, []int{1, 2, 3}, nil))
+	d.update(msgAlertEsc(3, at))
+	d.update(msgAlertDeesc(1, at.Add(time.Minute)))
+	d.update(msgAlertEsc(4, at.Add(2*time.Minute)))
+	d.update(msgReport(rep))
+
+	screen := strings.Join(d.lines(80, 30), "\n")
+
+	expected := []string{
+		"hits avg 3 / 2",
+		"ALERT",
+		"Top 2 sections, by hits",
+		" /images",
+		" /shuttle",
+		"2017-02-06T01:48:10Z · High traffic generated an alert - hits = 3",
+		"2017-02-06T01:49:10Z · High traffic alert recovered. Current hits = 1",
+		"2017-02-06T01:50:10Z · High traffic generated an alert - hits = 4",
+	}
+	for _, s := range expected {
+		if !strings.Contains(screen, s) {
+			t.Errorf("Expected %q on screen:\n%s", s, screen)
+		}
+	}
+
+	if strings.Contains(screen, "/history") {
+		t.Errorf("Section beyond top N should not be shown:\n%s", screen)
+	}
+
+	if n := len(d.lines(80, 30)); n != 30 {
+		t.Errorf("Expected screen of %d lines, got %d", 30, n)
+	}
+}
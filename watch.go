@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// errWatchUnsupported is returned by NewWatcher on platforms without file events,
+// log files are read on polls only.
+var errWatchUnsupported = errors.New("File events are not supported on this platform.")
+
+// watchPaths returns log files and patterns of the session to watch for writes.
+// Patterns with a glob in the directory part are left to polls, their directories are not known in advance.
+func watchPaths(s *Session) []string {
+	var out []string
+
+	for _, src := range s.Sources {
+		if _, ok := src.(*FileSource); ok {
+			out = append(out, src.Name())
+		}
+	}
+
+	for _, p := range s.Patterns {
+		if !isGlob(filepath.Dir(p)) {
+			out = append(out, p)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,149 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask selects events signalling new data in a directory: writes, new and renamed files.
+const watchMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_MOVED_TO
+
+// Watcher signals writes to watched files using inotify.
+// Directories of files are watched, so rotated and newly matched files are covered too,
+// events of other files in the same directories are ignored.
+// Events are coalesced: a signal means something was written since the previous one was received.
+type Watcher struct {
+	file   *os.File
+	events chan struct{}
+	done   chan struct{} // closed when reading stops
+
+	mu    sync.Mutex
+	dirs  map[int32]string // watch descriptor -> directory
+	paths map[string]bool  // file names and patterns watched
+}
+
+// NewWatcher creates an inotify instance and starts reading its events.
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &Watcher{
+		// Non-blocking descriptor goes to the runtime poller, so Close interrupts a pending read.
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		dirs:   make(map[int32]string),
+		paths:  make(map[string]bool),
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+// Add starts watching a file or files matching a pattern, adding one again has no effect.
+func (w *Watcher) Add(path string) error {
+	// Events are matched against cleaned names, ex. ./access.log is reported as access.log.
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	wd, err := syscall.InotifyAddWatch(int(w.file.Fd()), dir, watchMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+
+	w.mu.Lock()
+	w.dirs[int32(wd)] = dir
+	w.paths[path] = true
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Events returns a channel receiving a value after writes to watched files.
+func (w *Watcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Close stops watching and waits for events to stop.
+func (w *Watcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	return err
+}
+
+func (w *Watcher) read() {
+	defer close(w.done)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		if !w.relevant(buf[:n]) {
+			continue
+		}
+
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// relevant tells whether a batch of inotify events has one of a watched file.
+// A queue overflow counts as relevant, events might have been lost.
+func (w *Watcher) relevant(buf []byte) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+		off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+		if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			return true
+		}
+
+		dir, ok := w.dirs[ev.Wd]
+		if !ok || len(name) == 0 {
+			continue
+		}
+
+		if w.watched(filepath.Join(dir, string(bytes.TrimRight(name, "\x00")))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watched tells whether path is a watched file or matches a watched pattern, mu must be held.
+func (w *Watcher) watched(path string) bool {
+	if w.paths[path] {
+		return true
+	}
+
+	for p := range w.paths {
+		if isGlob(p) {
+			if ok, _ := filepath.Match(p, path); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
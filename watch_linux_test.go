@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Add(filepath.Join(dir, "*.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other files in the directory are ignored.
+	appendFile(t, filepath.Join(dir, "access.log.1"), "x\n")
+
+	select {
+	case <-w.Events():
+		t.Error("Expected no event after a write to another file")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	appendFile(t, filepath.Join(dir, "access.log"), "x\n")
+
+	select {
+	case <-w.Events():
+	case <-time.After(time.Second):
+		t.Error("Expected an event after a write")
+	}
+
+	// Close interrupts the reading goroutine.
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected Close to stop reading events")
+	}
+}
+
+func TestWatcher_RelativePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htm-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Add("./" + rel + "/./access.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, filepath.Join(dir, "access.log"), "x\n")
+
+	select {
+	case <-w.Events():
+	case <-time.After(time.Second):
+		t.Error("Expected an event after a write to a file added by a relative path")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// Watcher is not supported, log files are read on polls only.
+type Watcher struct{}
+
+// NewWatcher returns errWatchUnsupported.
+func NewWatcher() (*Watcher, error) {
+	return nil, errWatchUnsupported
+}
+
+// Add does nothing.
+func (w *Watcher) Add(path string) error {
+	return nil
+}
+
+// Events returns nil, a channel which never receives.
+func (w *Watcher) Events() <-chan struct{} {
+	return nil
+}
+
+// Close does nothing.
+func (w *Watcher) Close() error {
+	return nil
+}
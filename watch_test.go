@@ -0,0 +1,18 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchPaths(t *testing.T) {
+	s := NewSession(2, time.Second, nil)
+	s.Sources = []Source{&FileSource{path: "/var/log/a.log"}, &StreamSource{name: stdinName}}
+	s.Patterns = []string{"/var/log/nginx/*.log", "/srv/*/access.log"}
+
+	expected := []string{"/var/log/a.log", "/var/log/nginx/*.log"}
+	if actual := watchPaths(s); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	webEventsPath = "/events"
+	webKeepAlive  = 15 * time.Second
+)
+
+// WebUI serves a live dashboard page and a Server-Sent Events stream of monitor messages.
+type WebUI struct {
+	config func() *Config // configuration in effect, changes on reload
+	hub    *Hub
+}
+
+// NewWebUI returns a web dashboard fed by hub, settings are read from config when a client connects.
+func NewWebUI(config func() *Config, hub *Hub) *WebUI {
+	return &WebUI{
+		config: config,
+		hub:    hub,
+	}
+}
+
+// Register adds dashboard handlers to mux.
+func (u *WebUI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/", u.index)
+	mux.HandleFunc(webEventsPath, u.events)
+}
+
+// index serves the dashboard page, assets are embedded into the binary.
+func (u *WebUI) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, dashboardHTML)
+}
+
+// events streams monitor messages as Server-Sent Events.
+// A new client first receives the alert history, the last report and the last point.
+func (u *WebUI) events(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, snap := u.hub.Subscribe()
+	defer u.hub.Unsubscribe(ch)
+
+	cfg := u.config()
+	c, _ := json.Marshal(struct {
+		File    string  `json:"file"`
+		PollInt float64 `json:"pollInterval"` // seconds, points are hits per poll
+		TopN    uint    `json:"topN"`
+	}{strings.Join(cfg.Files, ", "), cfg.PollInt.Seconds(), cfg.TopN})
+	fmt.Fprintf(w, "event: config\ndata: %s\n\n", c)
+
+	for _, e := range snap {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	fl.Flush()
+
+	keepAlive := time.NewTicker(webKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case e := <-ch:
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			fl.Flush()
+
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			fl.Flush()
+		}
+	}
+}
+
+// writeEvent writes an event in SSE format, named after the message type.
+func writeEvent(w io.Writer, e event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+	return err
+}
@@ -0,0 +1,233 @@
+package main
+
+// dashboardHTML is the web dashboard page, kept in the binary to run without any files on disk.
+// It listens to webEventsPath and renders every event type sent by the monitor.
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>HTTP traffic monitor</title>
+<style>
+  body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; background: #f4f5f7; color: #222; }
+  header { background: #222; color: #fff; padding: 12px 20px; display: flex; justify-content: space-between; align-items: center; }
+  header h1 { font-size: 18px; margin: 0; }
+  main { display: grid; grid-template-columns: 1fr 1fr; gap: 16px; padding: 16px 20px; }
+  section { background: #fff; border-radius: 4px; padding: 12px 16px; box-shadow: 0 1px 2px rgba(0,0,0,.1); }
+  section.wide { grid-column: 1 / 3; }
+  h2 { font-size: 14px; text-transform: uppercase; color: #666; margin: 0 0 8px; }
+  table { width: 100%; border-collapse: collapse; }
+  td { padding: 3px 0; border-bottom: 1px solid #eee; }
+  td.num { text-align: right; width: 80px; }
+  .state { padding: 2px 10px; border-radius: 3px; font-weight: bold; }
+  .ok { background: #2e7d32; } .alert { background: #c62828; }
+  .big { font-size: 32px; font-weight: bold; }
+  .bar { height: 14px; display: inline-block; vertical-align: middle; }
+  .c2 { background: #2e7d32; } .c3 { background: #1565c0; } .c4 { background: #f9a825; } .c5 { background: #c62828; }
+  #alerts li.esc { color: #c62828; } #alerts li.deesc { color: #2e7d32; }
+  #alerts { max-height: 320px; overflow-y: auto; margin: 0; padding-left: 18px; }
+  #error { color: #8a6d00; }
+  svg { width: 100%; height: 60px; }
+</style>
+</head>
+<body>
+<header>
+  <h1>HTTP traffic monitor <small id="file"></small></h1>
+  <span id="state" class="state ok">OK</span>
+</header>
+<main>
+  <section>
+    <h2>Current traffic</h2>
+    <div><span id="traffic" class="big">-</span> hits avg, threshold <span id="threshold">-</span></div>
+    <div id="rates"></div>
+    <svg id="spark" viewBox="0 0 100 20" preserveAspectRatio="none"><polyline id="line" fill="none" stroke="#1565c0" stroke-width="0.5"/></svg>
+    <div id="error"></div>
+  </section>
+  <section>
+    <h2>Status codes <small id="reportTime"></small></h2>
+    <table id="codes"></table>
+    <p>Total hits: <b id="total">-</b><span id="visitorsBox" hidden>, visitors: <b id="visitors">-</b></span></p>
+  </section>
+  <section>
+    <h2>Top sections</h2>
+    <table id="sections"><tr><td>no entries</td></tr></table>
+  </section>
+  <section>
+    <h2>Bandwidth</h2>
+    <p><b id="bytes">-</b> sent, average <b id="avgBytes">-</b>, max <b id="maxBytes">-</b></p>
+    <table id="sectionBytes"><tr><td>no entries</td></tr></table>
+  </section>
+  <section id="latencyBox" hidden>
+    <h2>Latency</h2>
+    <table id="latency"></table>
+  </section>
+  <section id="sourcesBox" hidden>
+    <h2>Sources</h2>
+    <table id="sources"></table>
+  </section>
+  <section>
+    <h2>Alert history (<span id="alertCount">0</span>)</h2>
+    <ul id="alerts"></ul>
+  </section>
+</main>
+<script>
+(function () {
+  var $ = function (id) { return document.getElementById(id); };
+  var round = function (v) { return Math.round(v * 100) / 100; };
+
+  var size = function (v) {
+    var units = ["B", "KiB", "MiB", "GiB", "TiB"], i = 0;
+    while (v >= 1024 && i < units.length - 1) { v /= 1024; i++; }
+    return round(v) + " " + units[i];
+  };
+
+  function text(tag, s, cls) {
+    var el = document.createElement(tag);
+    el.textContent = s;
+    if (cls) { el.className = cls; }
+    return el;
+  }
+
+  function row(cells) {
+    var tr = document.createElement("tr");
+    cells.forEach(function (c) { tr.appendChild(c); });
+    return tr;
+  }
+
+  var es = new EventSource("events");
+
+  var pollInterval = 1;
+
+  es.addEventListener("config", function (ev) {
+    var c = JSON.parse(ev.data);
+    $("file").textContent = c.file;
+    pollInterval = c.pollInterval || 1;
+  });
+
+  es.addEventListener("point", function (ev) {
+    var p = JSON.parse(ev.data);
+    $("traffic").textContent = round(p.traffic);
+    $("threshold").textContent = round(p.threshold);
+    $("traffic").style.color = p.traffic >= p.threshold ? "#c62828" : "";
+    $("rates").textContent = (p.rates || []).map(function (r) {
+      return r.window + " " + round(r.rate);
+    }).join(" · ");
+
+    var pts = p.points || [];
+    // Points are hits per poll, the threshold is hits per second.
+    var max = Math.max.apply(null, pts.concat([p.threshold * pollInterval, 1]));
+    var step = pts.length > 1 ? 100 / (pts.length - 1) : 100;
+    $("line").setAttribute("points", pts.map(function (v, i) {
+      return (i * step).toFixed(2) + "," + (20 - v / max * 20).toFixed(2);
+    }).join(" "));
+  });
+
+  es.addEventListener("report", function (ev) {
+    var r = JSON.parse(ev.data).report;
+    $("reportTime").textContent = new Date(JSON.parse(ev.data).time).toLocaleTimeString();
+    $("total").textContent = r.totalHits;
+    $("visitorsBox").hidden = !r.sectionVisitors;
+    $("visitors").textContent = r.visitors || 0;
+
+    var codes = $("codes");
+    codes.innerHTML = "";
+    var max = Math.max(1, r.statusCodes["2xx"], r.statusCodes["3xx"], r.statusCodes["4xx"], r.statusCodes["5xx"]);
+    ["2xx", "3xx", "4xx", "5xx"].forEach(function (k, i) {
+      var v = r.statusCodes[k] || 0;
+      var bar = text("span", "", "bar c" + (i + 2));
+      bar.style.width = (v / max * 100) + "%";
+      var td = document.createElement("td");
+      td.appendChild(bar);
+      codes.appendChild(row([text("td", k), td, text("td", v, "num")]));
+    });
+
+    var sections = $("sections");
+    sections.innerHTML = "";
+    if (!r.sections.length) {
+      sections.appendChild(row([text("td", "no entries")]));
+    }
+    r.sections.forEach(function (s) {
+      var err = (r.sectionErrors || {})[s.key];
+      var cells = [text("td", s.key), text("td", err ? s.value + " \u00B1" + err : s.value, "num")];
+      if (r.sectionVisitors) {
+        cells.push(text("td", (r.sectionVisitors[s.key] || 0) + " visitors", "num"));
+      }
+      sections.appendChild(row(cells));
+    });
+
+    $("bytes").textContent = size(r.bytes);
+    $("avgBytes").textContent = size(r.totalHits ? r.bytes / r.totalHits : 0);
+    $("maxBytes").textContent = size(r.maxBytes);
+    var sectionBytes = $("sectionBytes");
+    sectionBytes.innerHTML = "";
+    if (!r.sectionBytes.length) {
+      sectionBytes.appendChild(row([text("td", "no entries")]));
+    }
+    r.sectionBytes.forEach(function (s) {
+      sectionBytes.appendChild(row([text("td", s.key), text("td", size(s.value), "num")]));
+    });
+
+    // Durations are in nanoseconds.
+    var ms = function (v) { return round(v / 1e6) + " ms"; };
+    var latency = $("latency");
+    latency.innerHTML = "";
+    $("latencyBox").hidden = !r.latency;
+    if (r.latency) {
+      latency.appendChild(row(["", "p50", "p90", "p95", "p99", "max"].map(function (h) { return text("td", h, h ? "num" : ""); })));
+      var lrow = function (name, st) {
+        latency.appendChild(row([text("td", name)].concat([st.p50, st.p90, st.p95, st.p99, st.max].map(function (v) {
+          return text("td", ms(v), "num");
+        }))));
+      };
+      lrow("all", r.latency);
+      r.sections.forEach(function (s) {
+        if (r.sectionLatency && r.sectionLatency[s.key]) { lrow(s.key, r.sectionLatency[s.key]); }
+      });
+    }
+
+    var sources = $("sources");
+    sources.innerHTML = "";
+    $("sourcesBox").hidden = !r.sources;
+    Object.keys(r.sources || {}).sort().forEach(function (k) {
+      sources.appendChild(row([text("td", k), text("td", r.sources[k], "num")]));
+    });
+  });
+
+  function alert(ev) {
+    var a = JSON.parse(ev.data);
+    var esc = a.type === "alertEsc";
+    var t = new Date(a.time).toLocaleString();
+    var s;
+    if (a.rule) {
+      s = esc ?
+        "Rule " + a.rule + " (" + a.metric + ") generated an alert - value = " + round(a.traffic) + ", triggered at " + t :
+        "Rule " + a.rule + " (" + a.metric + ") alert recovered. Current value = " + round(a.traffic) + ". At " + t;
+    } else {
+      s = esc ?
+        "High traffic generated an alert - hits = " + round(a.traffic) + ", triggered at " + t :
+        "High traffic alert recovered. Current hits = " + round(a.traffic) + ". At " + t;
+    }
+    $("alerts").appendChild(text("li", s, esc ? "esc" : "deesc"));
+    $("alertCount").textContent = $("alerts").children.length;
+    if (a.rule) {
+      return;
+    }
+    $("state").textContent = esc ? "ALERT" : "OK";
+    $("state").className = "state " + (esc ? "alert" : "ok");
+  }
+  es.addEventListener("alertEsc", alert);
+  es.addEventListener("alertDeesc", alert);
+
+  es.addEventListener("err", function (ev) {
+    $("error").textContent = JSON.parse(ev.data).body;
+  });
+
+  es.onerror = function () {
+    // EventSource reconnects by itself and the server replays the alert history,
+    // start from scratch to avoid duplicates.
+    $("alerts").innerHTML = "";
+  };
+})();
+</script>
+</body>
+</html>
+`
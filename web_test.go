@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func TestWebUI_index(t *testing.T) {
+	mux := http.NewServeMux()
+	NewWebUI(func() *Config { return &Config{} }, NewHub()).Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "EventSource") {
+		t.Errorf("Unexpected index response %d:\n%s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestWebUI_events(t *testing.T) {
+	hub := NewHub()
+	hub.Publish(msgAlertEsc(3, time.Date(2017, 2, 6, 1, 48, 10, 0, time.UTC)))
+
+	mux := http.NewServeMux()
+	NewWebUI(func() *Config { return &Config{Files: []string{"server.log"}, PollInt: 10 * time.Second, TopN: 5} }, hub).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest("GET", srv.URL+webEventsPath, nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Cannot connect: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream, got %s", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	next := func() string {
+		var lines []string
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Cannot read event: %s", err.Error())
+			}
+			if l == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, l)
+		}
+	}
+
+	expected := "event: config\ndata: {\"file\":\"server.log\",\"pollInterval\":10,\"topN\":5}\n"
+	if actual := next(); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	if actual := next(); !strings.HasPrefix(actual, "event: alertEsc\ndata: {\"type\":\"alertEsc\",\"time\":\"2017-02-06T01:48:10Z\"") {
+		t.Errorf("Unexpected history event %q", actual)
+	}
+
+	// Wait for the handler to subscribe before publishing a live event.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		hub.Publish(msgPoint(4, 2, []int{4}, nil))
+	}()
+
+	if actual := next(); !strings.HasPrefix(actual, "event: point\n") || !strings.Contains(actual, "\"traffic\":4") {
+		t.Errorf("Unexpected live event %q", actual)
+	}
+}
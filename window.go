@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Window is a rolling sum of the latest points kept in a ring buffer,
+// every point is added in O(1) regardless of the window length.
+type Window struct {
+	Len time.Duration
+
+	res    time.Duration // point length
+	points ring
+}
+
+// WindowRate is a rolling rate of one window.
+type WindowRate struct {
+	Window string  `json:"window"` // ex. "5m"
+	Rate   float64 `json:"rate"`   // hits per second
+}
+
+// NewWindow returns an empty window of length made of points of res length.
+func NewWindow(length, res time.Duration) *Window {
+	return &Window{
+		Len:    length,
+		res:    res,
+		points: newRing(int(length / res)),
+	}
+}
+
+// Add records the next point, the oldest one leaves the window.
+func (w *Window) Add(v int) {
+	w.points.add(v)
+}
+
+// AddLast adds hits to the latest point.
+func (w *Window) AddLast(v int) {
+	w.points.addLast(v)
+}
+
+// Skip records n empty points.
+func (w *Window) Skip(n int64) {
+	w.points.skip(n)
+}
+
+// Rate returns hits per second over the window, during warm-up over points recorded so far.
+func (w *Window) Rate() float64 {
+	return calcAvgTraffic(w.points.sum, w.points.filled, w.res)
+}
+
+// windowBuckets is a number of sketches visitor and latency windows consist of,
+// a window moves by a bucket, a 60th of its length.
+const windowBuckets = 60
+
+// VisitorWindow counts distinct visitors over a rolling window in fixed memory,
+// visitors of every bucket are kept in a HyperLogLog sketch.
+type VisitorWindow struct {
+	Len time.Duration
+
+	buckets []*HLL
+	last    int64 // index of the current bucket since the Unix epoch
+	sum     *HLL  // sketch buckets are merged in to count, kept to avoid allocations
+}
+
+// NewVisitorWindow returns an empty visitor window of length.
+func NewVisitorWindow(length time.Duration) *VisitorWindow {
+	w := &VisitorWindow{
+		Len:     length,
+		buckets: make([]*HLL, windowBuckets),
+		sum:     NewHLL(hllWindowPrecision),
+	}
+	for i := range w.buckets {
+		w.buckets[i] = NewHLL(hllWindowPrecision)
+	}
+	return w
+}
+
+// Add merges visitors seen at time t, buckets older than the window are emptied.
+func (w *VisitorWindow) Add(t time.Time, h *HLL) {
+	i := advanceBuckets(&w.last, t, w.Len, func(i int) {
+		w.buckets[i].reset()
+	})
+	w.buckets[i].Merge(h)
+}
+
+// Count returns an estimated number of distinct visitors over the window.
+func (w *VisitorWindow) Count() int {
+	w.sum.reset()
+	for _, b := range w.buckets {
+		w.sum.Merge(b)
+	}
+	return w.sum.Count()
+}
+
+// LatencyWindow estimates latency quantiles over a rolling window,
+// latencies of every bucket are kept in a Quantiles sketch.
+type LatencyWindow struct {
+	Len time.Duration
+
+	buckets []*Quantiles
+	last    int64      // index of the current bucket since the Unix epoch
+	sum     *Quantiles // sketch buckets are merged in to estimate quantiles
+}
+
+// NewLatencyWindow returns an empty latency window of length.
+func NewLatencyWindow(length time.Duration) *LatencyWindow {
+	w := &LatencyWindow{
+		Len:     length,
+		buckets: make([]*Quantiles, windowBuckets),
+		sum:     NewQuantiles(),
+	}
+	for i := range w.buckets {
+		w.buckets[i] = NewQuantiles()
+	}
+	return w
+}
+
+// Add merges latencies seen at time t, buckets older than the window are emptied.
+func (w *LatencyWindow) Add(t time.Time, q *Quantiles) {
+	i := advanceBuckets(&w.last, t, w.Len, func(i int) {
+		w.buckets[i].reset()
+	})
+	w.buckets[i].Merge(q)
+}
+
+// Stats returns latency quantiles over the window, nil if there were no latencies.
+func (w *LatencyWindow) Stats() *LatencyStats {
+	w.sum.reset()
+	for _, b := range w.buckets {
+		w.sum.Merge(b)
+	}
+	return w.sum.Stats()
+}
+
+// advanceBuckets moves the current bucket of a window of length made of windowBuckets to time t
+// and returns its slot, reset is called for slots of buckets which left the window.
+// last is an index of the current bucket since the Unix epoch, a time earlier than it stays in it.
+func advanceBuckets(last *int64, t time.Time, length time.Duration, reset func(i int)) int {
+	res := int64(length / windowBuckets)
+	if res < 1 {
+		res = 1
+	}
+
+	n := t.UnixNano() / res
+	for i := int64(1); i <= n-*last && i <= windowBuckets; i++ {
+		reset(int((*last + i) % windowBuckets))
+	}
+	if n > *last {
+		*last = n
+	}
+
+	return int(*last % windowBuckets)
+}
+
+// windowName returns a short name of a window length, ex. "1m", "90s", "1h30m".
+func windowName(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// windowMetric returns a name of the rule metric of a window, ex. "rate_5m".
+func windowMetric(d time.Duration) string {
+	return metricRatePrefix + windowName(d)
+}
+
+// latencyMetrics returns names of latency rule metrics of a window, ex. "latency_p99_5m".
+func latencyMetrics(d time.Duration) []string {
+	out := make([]string, len(latencyQuantiles))
+	for i, q := range latencyQuantiles {
+		out[i] = metricLatencyPrefix + q + "_" + windowName(d)
+	}
+	return out
+}
+
+// visitorMetric returns a name of the distinct visitors rule metric of a window, ex. "visitors_1m".
+func visitorMetric(d time.Duration) string {
+	return metricVisitorsPrefix + windowName(d)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindow_Rate(t *testing.T) {
+	w := NewWindow(3*time.Second, time.Second) // window of 3 points
+	w.Add(3)
+
+	// Warm-up, the rate is over points recorded so far.
+	if w.Rate() != 3 {
+		t.Errorf("Expected rate %v during warm-up, got %v", 3, w.Rate())
+	}
+
+	w.Add(1)
+	w.AddLast(1)
+	w.Add(2)
+	w.Add(6) // the first point leaves the window
+
+	if expected := 10.0 / 3; w.Rate() != expected {
+		t.Errorf("Expected rate %v, got %v", expected, w.Rate())
+	}
+
+	w.Skip(10)
+	if w.Rate() != 0 {
+		t.Errorf("Expected rate %v after a gap, got %v", 0, w.Rate())
+	}
+}
+
+func TestFrame_Windows(t *testing.T) {
+	f := NewFrame(2*time.Second, time.Second) // frame of 2 items
+	f.AddWindows([]time.Duration{time.Second, 4 * time.Second})
+	f.Rec(at(0), 8)
+	f.Rec(at(1), 4)
+	f.Rec(at(3), 2) // one bucket skipped
+
+	expected := []WindowRate{{"1s", 2}, {"4s", 3.5}}
+	if actual := f.Rates(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected rates %+v, got %+v", expected, actual)
+	}
+}
+
+func TestWindowName(t *testing.T) {
+	tests := map[time.Duration]string{
+		90 * time.Second: "1m30s",
+		time.Minute:      "1m",
+		15 * time.Minute: "15m",
+		time.Hour:        "1h",
+		90 * time.Minute: "1h30m",
+	}
+
+	for d, expected := range tests {
+		if actual := windowName(d); actual != expected {
+			t.Errorf("windowName(%s): expected %q, got %q", d, expected, actual)
+		}
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	w := NewLatencyWindow(time.Minute)
+
+	for i, d := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, time.Second} {
+		q := NewQuantiles()
+		q.Add(d)
+		w.Add(at(float64(i*30)), q)
+	}
+
+	// The first point left the window.
+	st := w.Stats()
+	if st == nil || st.Max != time.Second || st.P50 < 19*time.Millisecond || st.P50 > 21*time.Millisecond {
+		t.Errorf("Expected p50 of ~20ms and max of 1s, got %+v", st)
+	}
+}
+
+func TestRuleValues(t *testing.T) {
+	f := NewFrame(time.Minute, time.Second)
+	f.AddWindows([]time.Duration{time.Minute})
+	at := time.Unix(60, 0)
+
+	poll := NewTally()
+	poll.Add(&Entry{Section: "/", StatusCode: "200", HasLatency: true, Latency: time.Second})
+
+	lw := NewLatencyWindow(time.Minute)
+	lw.Add(at, poll.Latency)
+	vw := NewVisitorWindow(time.Minute)
+
+	rules := []*Rule{{Name: "slow", Metric: "latency_p99_1m", Threshold: 1}}
+	values := ruleValues(rules, f, poll, []*VisitorWindow{vw}, []*LatencyWindow{lw})
+
+	if v := values["latency_p99_1m"]; v < 0.99 || v > 1.01 {
+		t.Errorf("Expected p99 of 1s, got %v", v)
+	}
+
+	// Window metrics no rule refers to are not estimated, quantiles of a window come together.
+	if _, ok := values["latency_max_1m"]; !ok {
+		t.Error("Expected max latency of the window")
+	}
+	for _, m := range []string{"rate_1m", "visitors_1m"} {
+		if _, ok := values[m]; ok {
+			t.Errorf("Unexpected value of %s", m)
+		}
+	}
+}